@@ -0,0 +1,63 @@
+package traefik_plugin_ip2location
+
+import (
+	"net"
+	"strings"
+)
+
+// addressClassPublic is the class of every address not listed below.
+const addressClassPublic = "public"
+
+// addressClassRanges lists the non-public ranges of the IANA IPv4 and IPv6
+// Special-Purpose Address Registries by class. Teredo (2001::/32), 6to4
+// (2002::/16) and NAT64 (64:ff9b::/96) are left out as they embed a public
+// IPv4 address that the lookup resolves. The first matching range wins.
+var addressClassRanges = []struct {
+	class string
+	cidrs string
+}{
+	{"unspecified", "::/128"},
+	{"this_network", "0.0.0.0/8"},
+	{"private", "10.0.0.0/8 172.16.0.0/12 192.168.0.0/16 64:ff9b:1::/48"},
+	{"unique_local", "fc00::/7"},
+	{"cgnat", "100.64.0.0/10"},
+	{"loopback", "127.0.0.0/8 ::1/128"},
+	{"link_local", "169.254.0.0/16 fe80::/10"},
+	{"ietf_protocol", "192.0.0.0/24 2001:10::/28 2001:20::/28 5f00::/16"},
+	{"documentation", "192.0.2.0/24 198.51.100.0/24 203.0.113.0/24 2001:db8::/32 3fff::/20"},
+	{"benchmarking", "198.18.0.0/15 2001:2::/48"},
+	{"discard", "100::/64"},
+	{"multicast", "224.0.0.0/4 ff00::/8"},
+	{"broadcast", "255.255.255.255/32"},
+	{"reserved", "192.88.99.0/24 240.0.0.0/4"},
+}
+
+type classNet struct {
+	class string
+	net   *net.IPNet
+}
+
+// addressClassNets holds addressClassRanges parsed, in the same order.
+var addressClassNets []classNet
+
+func init() {
+	for _, r := range addressClassRanges {
+		for _, cidr := range strings.Fields(r.cidrs) {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				panic(err)
+			}
+			addressClassNets = append(addressClassNets, classNet{class: r.class, net: ipNet})
+		}
+	}
+}
+
+// addressClassOf returns the special-purpose class of ip, or "public".
+func addressClassOf(ip net.IP) string {
+	for _, n := range addressClassNets {
+		if n.net.Contains(ip) {
+			return n.class
+		}
+	}
+	return addressClassPublic
+}
@@ -0,0 +1,100 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddressClassOf(t *testing.T) {
+	tests := map[string]string{
+		"10.1.2.3":              "private",
+		"192.168.1.1":           "private",
+		"172.31.255.255":        "private",
+		"172.32.0.1":            "public",
+		"100.64.0.1":            "cgnat",
+		"127.0.0.1":             "loopback",
+		"::1":                   "loopback",
+		"::ffff:127.0.0.1":      "loopback",
+		"169.254.169.254":       "link_local",
+		"fe80::1":               "link_local",
+		"fd12:3456::1":          "unique_local",
+		"192.0.2.1":             "documentation",
+		"2001:db8::1":           "documentation",
+		"198.18.0.1":            "benchmarking",
+		"224.0.0.251":           "multicast",
+		"255.255.255.255":       "broadcast",
+		"240.0.0.1":             "reserved",
+		"0.0.0.0":               "this_network",
+		"::":                    "unspecified",
+		"8.8.8.8":               "public",
+		"2606:4700::1111":       "public",
+		"2001:0:4136:e378::1":   "public",
+		"2002:5102:45a0::1":     "public",
+		"64:ff9b::808:808":      "public",
+		"64:ff9b:1::a00:1":      "private",
+		"2001:10::1":            "ietf_protocol",
+		"2001:4860:4860::8888":  "public",
+		"100::1":                "discard",
+		"192.0.0.9":             "ietf_protocol",
+		"192.88.99.1":           "reserved",
+		"3fff:fff::1":           "documentation",
+		"5f00::1":               "ietf_protocol",
+		"ff02::1":               "multicast",
+		"203.0.113.255":         "documentation",
+		"198.51.100.0":          "documentation",
+		"100.128.0.1":           "public",
+		"11.0.0.1":              "public",
+		"2a00:1450:4001:81c::1": "public",
+	}
+	for ip, want := range tests {
+		if got := addressClassOf(net.ParseIP(ip)); got != want {
+			t.Errorf("addressClassOf(%s) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestGeoIP_SpecialAddress(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "10.0.0.0", fields: map[string]string{"country_short": "US"}},
+		{from: "11.0.0.0", fields: map[string]string{"country_short": "DE"}},
+		{from: "12.0.0.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:           dbPath,
+		CountryCode:        "X-Country-Code",
+		AddressClass:       "X-Address-Class",
+		SpecialCountryCode: "ZZ",
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remote  string
+		country string
+		class   string
+	}{
+		{"10.0.0.1:1234", "ZZ", "private"},
+		{"[::1]:1234", "ZZ", "loopback"},
+		{"11.0.0.1:1234", "DE", "public"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.RemoteAddr = tt.remote
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got := req.Header.Get("X-Country-Code"); got != tt.country {
+			t.Errorf("%s: X-Country-Code = %q, want %q", tt.remote, got, tt.country)
+		}
+		if got := req.Header.Get("X-Address-Class"); got != tt.class {
+			t.Errorf("%s: X-Address-Class = %q, want %q", tt.remote, got, tt.class)
+		}
+		if got := req.Header.Get("X-GEOIP-ERROR"); got != "" {
+			t.Errorf("%s: unexpected error %q", tt.remote, got)
+		}
+	}
+}
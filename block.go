@@ -0,0 +1,161 @@
+package traefik_plugin_ip2location
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// countryPolicy decides whether a request may reach the backend based on the
+// country and continent of the client IP.
+type countryPolicy struct {
+	allowedCountries  map[string]bool
+	blockedCountries  map[string]bool
+	allowedContinents map[string]bool
+	blockedContinents map[string]bool
+	allowedGeofences  map[string]bool
+	blockedGeofences  map[string]bool
+	// failClosed rejects requests whose country cannot be determined,
+	// either because the lookup failed or the IP is not in the database.
+	failClosed bool
+	statusCode int
+	body       string
+	headers    map[string]string
+}
+
+// newCountryPolicy builds the policy from the configuration. It returns nil
+// when no allow or block list is configured. Geofence names are checked
+// against the loaded geofence file by the caller.
+func newCountryPolicy(config *Config) (*countryPolicy, error) {
+	if len(config.AllowedCountries) == 0 && len(config.BlockedCountries) == 0 &&
+		len(config.AllowedContinents) == 0 && len(config.BlockedContinents) == 0 &&
+		len(config.AllowedGeofences) == 0 && len(config.BlockedGeofences) == 0 {
+		return nil, nil
+	}
+
+	p := &countryPolicy{
+		failClosed: config.FailClosed,
+		statusCode: config.BlockStatusCode,
+		body:       config.BlockBody,
+		headers:    config.BlockHeaders,
+	}
+	if p.statusCode == 0 {
+		p.statusCode = http.StatusForbidden
+	}
+	if p.statusCode < 100 || p.statusCode > 599 {
+		return nil, fmt.Errorf("invalid block_status_code %d", p.statusCode)
+	}
+
+	var err error
+	if p.allowedCountries, err = countryCodeSet("allowed_countries", config.AllowedCountries); err != nil {
+		return nil, err
+	}
+	if p.blockedCountries, err = countryCodeSet("blocked_countries", config.BlockedCountries); err != nil {
+		return nil, err
+	}
+	if p.allowedContinents, err = continentCodeSet("allowed_continents", config.AllowedContinents); err != nil {
+		return nil, err
+	}
+	if p.blockedContinents, err = continentCodeSet("blocked_continents", config.BlockedContinents); err != nil {
+		return nil, err
+	}
+	p.allowedGeofences = nameSet(config.AllowedGeofences)
+	p.blockedGeofences = nameSet(config.BlockedGeofences)
+
+	return p, nil
+}
+
+func countryCodeSet(option string, codes []string) (map[string]bool, error) {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if len(code) != 2 {
+			return nil, fmt.Errorf("invalid country code %q in %s", code, option)
+		}
+		set[code] = true
+	}
+	return set, nil
+}
+
+func continentCodeSet(option string, codes []string) (map[string]bool, error) {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if _, ok := continentNames[code]; !ok {
+			return nil, fmt.Errorf("invalid continent code %q in %s", code, option)
+		}
+		set[code] = true
+	}
+	return set, nil
+}
+
+func nameSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[strings.TrimSpace(name)] = true
+	}
+	return set
+}
+
+// allowsGeofences reports whether a client inside the comma separated
+// geofences may pass. located is false when the client has no coordinates to
+// test.
+func (p *countryPolicy) allowsGeofences(geofences string, located bool) bool {
+	if len(p.allowedGeofences) == 0 && len(p.blockedGeofences) == 0 {
+		return true
+	}
+	if !located {
+		return !p.failClosed
+	}
+
+	var fences []string
+	if geofences != "" {
+		fences = strings.Split(geofences, ",")
+	}
+
+	for _, fence := range fences {
+		if p.blockedGeofences[fence] {
+			return false
+		}
+	}
+	if len(p.allowedGeofences) == 0 {
+		return true
+	}
+	for _, fence := range fences {
+		if p.allowedGeofences[fence] {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether a client located in country/continent may pass.
+// Block lists take precedence over allow lists.
+func (p *countryPolicy) allows(country, continent string) bool {
+	if country == "" || country == "-" {
+		return !p.failClosed
+	}
+
+	if p.blockedCountries[country] || p.blockedContinents[continent] {
+		return false
+	}
+
+	if len(p.allowedCountries) == 0 && len(p.allowedContinents) == 0 {
+		return true
+	}
+	return p.allowedCountries[country] || p.allowedContinents[continent]
+}
+
+// reject writes the configured block response.
+func (p *countryPolicy) reject(rw http.ResponseWriter) {
+	for name, value := range p.headers {
+		rw.Header().Set(name, value)
+	}
+	if p.body != "" && rw.Header().Get("Content-Type") == "" {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	rw.WriteHeader(p.statusCode)
+	if p.body != "" {
+		_, _ = rw.Write([]byte(p.body))
+	}
+}
@@ -0,0 +1,117 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCountryPolicy_Allows(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    Config
+		country   string
+		continent string
+		want      bool
+	}{
+		{"allow list match", Config{AllowedCountries: []string{"de", "AT"}}, "DE", "EU", true},
+		{"allow list miss", Config{AllowedCountries: []string{"DE"}}, "FR", "EU", false},
+		{"allowed continent", Config{AllowedCountries: []string{"US"}, AllowedContinents: []string{"EU"}}, "FR", "EU", true},
+		{"block list match", Config{BlockedCountries: []string{"RU"}}, "RU", "EU", false},
+		{"block list miss", Config{BlockedCountries: []string{"RU"}}, "DE", "EU", true},
+		{"blocked continent", Config{BlockedContinents: []string{"AS"}}, "CN", "AS", false},
+		{"block wins over allow", Config{AllowedContinents: []string{"EU"}, BlockedCountries: []string{"BY"}}, "BY", "EU", false},
+		{"unknown fails open", Config{AllowedCountries: []string{"DE"}}, "-", "", true},
+		{"unknown fails closed", Config{AllowedCountries: []string{"DE"}, FailClosed: true}, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := newCountryPolicy(&tt.config)
+			if err != nil {
+				t.Fatalf("newCountryPolicy failed: %v", err)
+			}
+			if got := policy.allows(tt.country, tt.continent); got != tt.want {
+				t.Errorf("allows(%q, %q) = %v, want %v", tt.country, tt.continent, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountryPolicy_InvalidConfig(t *testing.T) {
+	configs := []Config{
+		{AllowedCountries: []string{"DEU"}},
+		{BlockedContinents: []string{"XX"}},
+		{BlockedCountries: []string{"RU"}, BlockStatusCode: 42},
+	}
+	for _, config := range configs {
+		if _, err := newCountryPolicy(&config); err == nil {
+			t.Errorf("Expected error for config %+v", config)
+		}
+	}
+
+	if policy, err := newCountryPolicy(&Config{}); policy != nil || err != nil {
+		t.Errorf("Expected no policy without lists, got %v, %v", policy, err)
+	}
+}
+
+// TestGeoIP_Blocking tests that rejected requests get the block response and never reach the backend
+func TestGeoIP_Blocking(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "1.2.3.0", fields: map[string]string{"country_short": "DE"}},
+		{from: "1.2.4.0", fields: map[string]string{"country_short": "RU"}},
+		{from: "1.2.5.0", fields: map[string]string{"country_short": "-"}},
+	})
+
+	config := &Config{
+		Filename:           dbPath,
+		BlockedCountries:   []string{"RU"},
+		FailClosed:         true,
+		BlockStatusCode:    http.StatusUnavailableForLegalReasons,
+		BlockBody:          "not available in your region",
+		BlockHeaders:       map[string]string{"Cache-Control": "no-store"},
+		DisableErrorHeader: true,
+	}
+
+	reached := false
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { reached = true })
+
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		allowed    bool
+	}{
+		{"1.2.3.4:34000", true},
+		{"1.2.4.4:34000", false},
+		{"1.2.5.4:34000", false},
+	}
+	for _, tt := range tests {
+		reached = false
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/some/path", nil)
+		req.RemoteAddr = tt.remoteAddr
+		rw := httptest.NewRecorder()
+
+		handler.ServeHTTP(rw, req)
+
+		if reached != tt.allowed {
+			t.Errorf("%s: reached backend = %v, want %v", tt.remoteAddr, reached, tt.allowed)
+		}
+		if tt.allowed {
+			continue
+		}
+		if rw.Code != http.StatusUnavailableForLegalReasons {
+			t.Errorf("%s: status = %d, want 451", tt.remoteAddr, rw.Code)
+		}
+		if rw.Body.String() != "not available in your region" {
+			t.Errorf("%s: body = %q", tt.remoteAddr, rw.Body.String())
+		}
+		if rw.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: missing block header", tt.remoteAddr)
+		}
+	}
+}
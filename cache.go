@@ -0,0 +1,188 @@
+package traefik_plugin_ip2location
+
+import (
+	"container/list"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rangeLocator is implemented by readers that can report the range of
+// addresses a record applies to, so one cache entry can serve all of them.
+type rangeLocator interface {
+	getAllRange(ipaddress string) (IP2Locationrecord, ipRange, error)
+}
+
+// getAllRange looks ipaddress up in db, with the record's range when db can
+// report it.
+func getAllRange(db Locator, ipaddress string) (IP2Locationrecord, ipRange, error) {
+	if rl, ok := db.(rangeLocator); ok {
+		return rl.getAllRange(ipaddress)
+	}
+	record, err := db.Get_all(ipaddress)
+	return record, ipRange{}, err
+}
+
+// cacheEntry is a cached lookup result, keyed either by a single IP or,
+// when the database reported one, by the range of addresses it covers.
+type cacheEntry struct {
+	ip      string
+	r       ipRange
+	record  IP2Locationrecord
+	expires time.Time
+}
+
+// lookupCache is a bounded LRU cache of lookup results. Range entries are kept
+// sorted by their start so an address is matched with a binary search.
+type lookupCache struct {
+	size int
+	ttl  time.Duration
+
+	mu     sync.Mutex
+	lru    *list.List // of *cacheEntry, most recently used first
+	byIP   map[string]*list.Element
+	ranges []*list.Element // sorted by iptype, then from
+	// gen is bumped by purge, so results looked up before it are not added
+	gen uint64
+
+	hits   uint64
+	misses uint64
+}
+
+func newLookupCache(size int, ttl time.Duration) *lookupCache {
+	return &lookupCache{
+		size: size,
+		ttl:  ttl,
+		lru:  list.New(),
+		byIP: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached record for ip.
+func (c *lookupCache) get(ip net.IP) (IP2Locationrecord, bool) {
+	iptype, ipnum := ipnumber(ip)
+
+	c.mu.Lock()
+	el, ok := c.byIP[ip.String()]
+	if !ok {
+		if i := c.search(iptype, ipnum); i < len(c.ranges) && c.entry(c.ranges[i]).r.contains(iptype, ipnum) {
+			el, ok = c.ranges[i], true
+		}
+	}
+	if ok && c.ttl > 0 && time.Now().After(c.entry(el).expires) {
+		c.remove(el)
+		ok = false
+	}
+	var record IP2Locationrecord
+	if ok {
+		c.lru.MoveToFront(el)
+		record = c.entry(el).record
+	}
+	c.mu.Unlock()
+
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+	return record, ok
+}
+
+// generation returns the current generation, to be passed to add by a lookup
+// that starts now.
+func (c *lookupCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// add caches record for ip, or for every address in r when the range is known.
+// The record is dropped when the cache was purged since generation gen, as it
+// may come from a database that has been replaced.
+func (c *lookupCache) add(ip net.IP, record IP2Locationrecord, r ipRange, gen uint64) {
+	e := &cacheEntry{r: r, record: record}
+	if c.ttl > 0 {
+		e.expires = time.Now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	if r.iptype == 0 {
+		e.ip = ip.String()
+		if el, ok := c.byIP[e.ip]; ok {
+			c.remove(el)
+		}
+		c.byIP[e.ip] = c.lru.PushFront(e)
+	} else {
+		// ranges never overlap, so an entry starting at the same address is
+		// the same range stored twice by concurrent misses
+		i := c.search(r.iptype, r.from)
+		if i < len(c.ranges) {
+			if old := c.entry(c.ranges[i]).r; old.iptype == r.iptype && old.from == r.from {
+				c.remove(c.ranges[i])
+			} else if old.iptype == r.iptype && old.from.cmp(r.from) < 0 {
+				i++
+			}
+		}
+		c.ranges = append(c.ranges, nil)
+		copy(c.ranges[i+1:], c.ranges[i:])
+		c.ranges[i] = c.lru.PushFront(e)
+	}
+
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// purge drops every entry, e.g. after a database file was reloaded.
+func (c *lookupCache) purge() {
+	c.mu.Lock()
+	c.lru.Init()
+	c.byIP = make(map[string]*list.Element)
+	c.ranges = nil
+	c.gen++
+	c.mu.Unlock()
+}
+
+// stats returns the hit and miss counters.
+func (c *lookupCache) stats() (hits, misses uint64) {
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
+
+func (c *lookupCache) entry(el *list.Element) *cacheEntry {
+	return el.Value.(*cacheEntry)
+}
+
+// search returns the index of the last range starting at or before ipnum,
+// or the insertion index for a range starting at ipnum.
+func (c *lookupCache) search(iptype uint32, ipnum uint128) int {
+	i := sort.Search(len(c.ranges), func(i int) bool {
+		r := c.entry(c.ranges[i]).r
+		return r.iptype > iptype || (r.iptype == iptype && r.from.cmp(ipnum) > 0)
+	})
+	if i > 0 {
+		if r := c.entry(c.ranges[i-1]).r; r.iptype == iptype && r.from.cmp(ipnum) <= 0 {
+			return i - 1
+		}
+	}
+	return i
+}
+
+// remove drops el; the caller holds mu.
+func (c *lookupCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	if e.r.iptype == 0 {
+		delete(c.byIP, e.ip)
+		return
+	}
+	i := c.search(e.r.iptype, e.r.from)
+	if i < len(c.ranges) && c.ranges[i] == el {
+		c.ranges = append(c.ranges[:i], c.ranges[i+1:]...)
+	}
+}
@@ -0,0 +1,189 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testRange(from, to string) ipRange {
+	iptype, fromnum := ipnumber(net.ParseIP(from))
+	_, tonum := ipnumber(net.ParseIP(to))
+	return ipRange{iptype: iptype, from: fromnum, to: tonum}
+}
+
+func TestLookupCache_Range(t *testing.T) {
+	c := newLookupCache(10, 0)
+	c.add(net.ParseIP("10.0.0.1"), IP2Locationrecord{City: "A"}, testRange("10.0.0.0", "10.0.1.0"), 0)
+	c.add(net.ParseIP("10.0.2.1"), IP2Locationrecord{City: "C"}, testRange("10.0.2.0", "10.0.3.0"), 0)
+	c.add(net.ParseIP("10.0.1.1"), IP2Locationrecord{City: "B"}, testRange("10.0.1.0", "10.0.2.0"), 0)
+
+	tests := map[string]string{
+		"10.0.0.0":   "A",
+		"10.0.0.255": "A",
+		"10.0.1.0":   "B",
+		"10.0.2.200": "C",
+	}
+	for ip, want := range tests {
+		record, ok := c.get(net.ParseIP(ip))
+		if !ok || record.City != want {
+			t.Errorf("get(%s) = %q, %v, want %q", ip, record.City, ok, want)
+		}
+	}
+	for _, ip := range []string{"9.255.255.255", "10.0.3.0", "::a00:1"} {
+		if _, ok := c.get(net.ParseIP(ip)); ok {
+			t.Errorf("get(%s) hit, want miss", ip)
+		}
+	}
+
+	hits, misses := c.stats()
+	if hits != 4 || misses != 3 {
+		t.Errorf("stats = %d hits, %d misses, want 4, 3", hits, misses)
+	}
+}
+
+func TestLookupCache_Evicts(t *testing.T) {
+	c := newLookupCache(2, 0)
+	c.add(net.ParseIP("192.0.2.1"), IP2Locationrecord{City: "1"}, ipRange{}, 0)
+	c.add(net.ParseIP("192.0.2.2"), IP2Locationrecord{City: "2"}, ipRange{}, 0)
+	c.get(net.ParseIP("192.0.2.1"))
+	c.add(net.ParseIP("10.0.0.1"), IP2Locationrecord{City: "3"}, testRange("10.0.0.0", "10.1.0.0"), 0)
+
+	if _, ok := c.get(net.ParseIP("192.0.2.2")); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if _, ok := c.get(net.ParseIP("192.0.2.1")); !ok {
+		t.Error("expected recently used entry to be kept")
+	}
+
+	c.add(net.ParseIP("192.0.2.4"), IP2Locationrecord{City: "4"}, ipRange{}, 0)
+	if _, ok := c.get(net.ParseIP("10.0.0.1")); ok {
+		t.Error("expected range entry to be evicted")
+	}
+	if len(c.ranges) != 0 || len(c.byIP) != 2 {
+		t.Errorf("unexpected cache size: %d ranges, %d IPs", len(c.ranges), len(c.byIP))
+	}
+}
+
+func TestLookupCache_TTL(t *testing.T) {
+	c := newLookupCache(10, time.Millisecond)
+	c.add(net.ParseIP("192.0.2.1"), IP2Locationrecord{City: "1"}, ipRange{}, 0)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.get(net.ParseIP("192.0.2.1")); ok {
+		t.Error("expected expired entry to miss")
+	}
+	if c.lru.Len() != 0 {
+		t.Errorf("expected expired entry to be removed, %d left", c.lru.Len())
+	}
+}
+
+func TestLookupCache_PurgeDropsStaleAdds(t *testing.T) {
+	c := newLookupCache(10, 0)
+	ip := net.ParseIP("10.0.0.1")
+
+	// a lookup on the old database that finishes after the purge
+	gen := c.generation()
+	c.purge()
+	c.add(ip, IP2Locationrecord{City: "old"}, testRange("10.0.0.0", "10.0.1.0"), gen)
+	if _, ok := c.get(ip); ok {
+		t.Error("record looked up before the purge was cached")
+	}
+
+	c.add(ip, IP2Locationrecord{City: "new"}, testRange("10.0.0.0", "10.0.1.0"), c.generation())
+	if record, ok := c.get(ip); !ok || record.City != "new" {
+		t.Errorf("get = %+v, %v, want the record looked up after the purge", record, ok)
+	}
+}
+
+func TestGeoIP_Cache(t *testing.T) {
+	dbPath := buildTestBIN(t, 3, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB", "city": "London"}},
+		{from: "81.2.70.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:      dbPath,
+		City:          "X-City",
+		CacheSize:     100,
+		CacheTTL:      "1m",
+		ContinentCode: "X-Continent",
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	for _, ip := range []string{"81.2.69.1", "81.2.69.2", "81.2.69.250"} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.RemoteAddr = ip + ":1234"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got := req.Header.Get("X-City"); got != "London" {
+			t.Errorf("%s: X-City = %q, want London", ip, got)
+		}
+		if got := req.Header.Get("X-Continent"); got != "EU" {
+			t.Errorf("%s: X-Continent = %q, want EU", ip, got)
+		}
+	}
+
+	hits, misses := handler.(*GeoIP).cache.stats()
+	if hits != 2 || misses != 1 {
+		t.Errorf("stats = %d hits, %d misses, want 2, 1", hits, misses)
+	}
+}
+
+func TestGeoIP_CacheSpecialAddress(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "100.0.0.0", fields: map[string]string{"country_short": "US"}},
+		{from: "101.0.0.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:           dbPath,
+		CountryCode:        "X-Country-Code",
+		AddressClass:       "X-Address-Class",
+		SpecialCountryCode: "ZZ",
+		CacheSize:          100,
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	// the first lookup caches 100.0.0.0-100.255.255.255, which spans the
+	// CGNAT block
+	tests := []struct {
+		remote  string
+		country string
+		class   string
+	}{
+		{"100.0.0.1:1234", "US", "public"},
+		{"100.64.0.1:1234", "ZZ", "cgnat"},
+		{"100.128.0.1:1234", "US", "public"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.RemoteAddr = tt.remote
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got := req.Header.Get("X-Country-Code"); got != tt.country {
+			t.Errorf("%s: X-Country-Code = %q, want %q", tt.remote, got, tt.country)
+		}
+		if got := req.Header.Get("X-Address-Class"); got != tt.class {
+			t.Errorf("%s: X-Address-Class = %q, want %q", tt.remote, got, tt.class)
+		}
+	}
+}
+
+func TestGeoIP_InvalidCacheTTL(t *testing.T) {
+	_, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:  "IP2LOCATION-LITE-DB1.BIN",
+		CacheSize: 10,
+		CacheTTL:  "soon",
+	}, "test")
+	if err == nil {
+		t.Fatal("Expected error for invalid cache_ttl")
+	}
+}
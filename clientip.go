@@ -0,0 +1,129 @@
+package traefik_plugin_ip2location
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Kinds of client IP sources.
+const (
+	sourceHeader     = "header"      // a header holding a single IP, e.g. X-Real-IP
+	sourceList       = "list"        // a comma separated proxy chain, e.g. X-Forwarded-For
+	sourceForwarded  = "forwarded"   // an RFC 7239 Forwarded header
+	sourceRemoteAddr = "remote_addr" // the address of the connecting peer
+)
+
+// ipSource is one entry of the ordered client IP source chain.
+type ipSource struct {
+	kind   string
+	header string
+	// trusted sources are only read when the peer is a trusted proxy
+	trusted bool
+}
+
+// parseIPSource parses a source written as kind[:header][:trusted|any], e.g.
+// "header:CF-Connecting-IP", "list:X-Forwarded-For", "forwarded" or
+// "header:X-Custom-IP:any". Header sources require a trusted peer unless
+// "any" is given.
+func parseIPSource(s string) (ipSource, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	src := ipSource{kind: strings.ToLower(parts[0])}
+	args := parts[1:]
+
+	trust := ""
+	if n := len(args); n > 0 && (args[n-1] == "trusted" || args[n-1] == "any") {
+		trust = args[n-1]
+		args = args[:n-1]
+	}
+	if len(args) > 1 {
+		return ipSource{}, fmt.Errorf("invalid ip_sources entry %q", s)
+	}
+	if len(args) == 1 {
+		src.header = strings.TrimSpace(args[0])
+	}
+
+	switch src.kind {
+	case sourceHeader, sourceList:
+		if src.header == "" {
+			return ipSource{}, fmt.Errorf("ip_sources entry %q needs a header name", s)
+		}
+	case sourceForwarded:
+		if src.header == "" {
+			src.header = "Forwarded"
+		}
+	case sourceRemoteAddr:
+		if src.header != "" || trust != "" {
+			return ipSource{}, fmt.Errorf("invalid ip_sources entry %q", s)
+		}
+		return src, nil
+	default:
+		return ipSource{}, fmt.Errorf("unknown ip_sources kind in %q", s)
+	}
+	src.trusted = trust != "any"
+	return src, nil
+}
+
+// ipSources returns the configured source chain, or the chain given by the
+// legacy from_header and use_* options when ip_sources is not set.
+func ipSources(config *Config) ([]ipSource, error) {
+	if len(config.IPSources) > 0 {
+		sources := make([]ipSource, 0, len(config.IPSources))
+		for _, s := range config.IPSources {
+			src, err := parseIPSource(s)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, src)
+		}
+		return sources, nil
+	}
+
+	var sources []ipSource
+	if config.FromHeader != "" {
+		sources = append(sources, ipSource{kind: sourceHeader, header: config.FromHeader})
+	}
+	if config.UseXRealIP {
+		sources = append(sources, ipSource{kind: sourceHeader, header: "X-Real-IP", trusted: true})
+	}
+	if config.UseXClientIP {
+		sources = append(sources, ipSource{kind: sourceHeader, header: "X-Client-IP", trusted: true})
+	}
+	if config.UseForwarded {
+		sources = append(sources, ipSource{kind: sourceForwarded, header: "Forwarded", trusted: true})
+	}
+	if config.UseXForwardedFor {
+		sources = append(sources, ipSource{kind: sourceList, header: "X-Forwarded-For", trusted: true})
+	}
+	return append(sources, ipSource{kind: sourceRemoteAddr}), nil
+}
+
+// ipFromSource returns the client IP given by a header source, or nil.
+func (g *GeoIP) ipFromSource(req *http.Request, src ipSource) net.IP {
+	switch src.kind {
+	case sourceHeader:
+		return g.parseIP(req.Header.Get(src.header))
+	case sourceList:
+		var chain []net.IP
+		for _, value := range req.Header.Values(src.header) {
+			for _, ipStr := range strings.Split(value, ",") {
+				chain = append(chain, g.parseIP(ipStr))
+			}
+		}
+		return g.clientFromChain(chain)
+	case sourceForwarded:
+		// An obfuscated or unknown client identifier falls through to the
+		// next source.
+		nodes, err := parseForwarded(req.Header.Values(src.header))
+		if err != nil {
+			return nil
+		}
+		chain := make([]net.IP, len(nodes))
+		for i, node := range nodes {
+			chain[i] = forwardedNodeIP(node)
+		}
+		return g.clientFromChain(chain)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseIPSource(t *testing.T) {
+	tests := map[string]ipSource{
+		"header:CF-Connecting-IP":       {kind: sourceHeader, header: "CF-Connecting-IP", trusted: true},
+		"header:X-Custom-IP:any":        {kind: sourceHeader, header: "X-Custom-IP"},
+		"list:X-Forwarded-For:trusted":  {kind: sourceList, header: "X-Forwarded-For", trusted: true},
+		"forwarded":                     {kind: sourceForwarded, header: "Forwarded", trusted: true},
+		"forwarded:any":                 {kind: sourceForwarded, header: "Forwarded"},
+		"Forwarded:X-Forwarded-Rfc7239": {kind: sourceForwarded, header: "X-Forwarded-Rfc7239", trusted: true},
+		"remote_addr":                   {kind: sourceRemoteAddr},
+	}
+	for s, want := range tests {
+		got, err := parseIPSource(s)
+		if err != nil {
+			t.Errorf("parseIPSource(%q) failed: %v", s, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("parseIPSource(%q) = %+v, want %+v", s, got, want)
+		}
+	}
+
+	for _, s := range []string{"header", "list:", "cookie:ip", "remote_addr:any", "header:a:b:any", ""} {
+		if _, err := parseIPSource(s); err == nil {
+			t.Errorf("parseIPSource(%q) expected error", s)
+		}
+	}
+}
+
+func TestIPSources_Default(t *testing.T) {
+	config := CreateConfig()
+	config.FromHeader = "X-Custom-IP"
+
+	sources, err := ipSources(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ipSource{
+		{kind: sourceHeader, header: "X-Custom-IP"},
+		{kind: sourceHeader, header: "X-Real-IP", trusted: true},
+		{kind: sourceHeader, header: "X-Client-IP", trusted: true},
+		{kind: sourceList, header: "X-Forwarded-For", trusted: true},
+		{kind: sourceRemoteAddr},
+	}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("ipSources = %+v, want %+v", sources, want)
+	}
+}
+
+func TestGeoIP_IPSources(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.70.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:       dbPath,
+		ClientIp:       "X-Client-Addr",
+		TrustedProxies: []string{"10.0.0.0/8"},
+		IPSources: []string{
+			"header:CF-Connecting-IP",
+			"header:X-Test-IP:any",
+			"list:X-Forwarded-For",
+		},
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"trusted peer", "10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "81.2.69.1", "X-Test-IP": "81.2.69.2"}, "81.2.69.1"},
+		{"untrusted peer skips trusted sources", "192.0.2.1:1234", map[string]string{"CF-Connecting-IP": "81.2.69.1", "X-Test-IP": "81.2.69.2"}, "81.2.69.2"},
+		{"order", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "81.2.69.3", "X-Test-IP": "81.2.69.2"}, "81.2.69.2"},
+		{"list", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "81.2.69.3, 10.0.0.9"}, "81.2.69.3"},
+		{"no remote_addr fallback", "192.0.2.1:1234", map[string]string{"X-Forwarded-For": "81.2.69.3"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got := req.Header.Get("X-Client-Addr"); got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
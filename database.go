@@ -0,0 +1,63 @@
+package traefik_plugin_ip2location
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// Locator is the lookup interface shared by the IP2Location BIN reader (*DB)
+// and the MaxMind DB reader (*MMDB).
+type Locator interface {
+	Get_all(ipaddress string) (IP2Locationrecord, error)
+	Close()
+}
+
+// OpenDatabase opens dbpath with the reader matching its contents. Files that
+// carry the MaxMind DB metadata marker are opened with OpenMMDB, anything else
+// is treated as an IP2Location BIN file. BIN files are loaded into memory when
+// inMemory is set; MMDB files always are.
+func OpenDatabase(dbpath string, inMemory bool) (Locator, error) {
+	isMMDB, err := sniffMMDB(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	if isMMDB {
+		db, err := OpenMMDB(dbpath)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	db, err := openDB(dbpath, inMemory)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// sniffMMDB reports whether the tail of the file contains the MMDB metadata marker.
+func sniffMMDB(dbpath string) (bool, error) {
+	f, err := os.Open(dbpath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	size := info.Size()
+	tail := int64(mmdbMetadataMaxSize)
+	if size < tail {
+		tail = size
+	}
+	buf := make([]byte, tail)
+	if _, err := f.ReadAt(buf, size-tail); err != nil && err != io.EOF {
+		return false, err
+	}
+
+	return bytes.Contains(buf, mmdbMetadataMarker), nil
+}
@@ -0,0 +1,149 @@
+package traefik_plugin_ip2location
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// recordFields returns the non-empty fields of record, keyed by the name of
+// their header option. Coordinates, elevation and accuracy radius are numbers.
+func recordFields(record IP2Locationrecord) map[string]interface{} {
+	fields := map[string]interface{}{}
+	str := func(name, value string) {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	num := func(name string, value float64) {
+		if value != 0 {
+			fields[name] = value
+		}
+	}
+
+	str("country_code", record.Country_short)
+	str("country_name", record.Country_long)
+	str("region", record.Region)
+	str("region_code", record.Regioncode)
+	str("city", record.City)
+	str("postal_code", record.Zipcode)
+	num("latitude", float64(record.Latitude))
+	num("longitude", float64(record.Longitude))
+	str("timezone", record.Timezone)
+	str("timezone_name", record.Timezonename)
+	str("continent_code", record.Continentcode)
+	str("continent_name", record.Continentname)
+	str("isp", record.Isp)
+	str("asn", record.Asn)
+	str("asn_organization", record.As)
+	str("domain", record.Domain)
+	if record.Netspeed != "" {
+		str("connection_type", connectionTypeOf(record.Netspeed))
+	}
+	str("user_type", userTypeOf(record.Usagetype))
+	num("accuracy_radius", float64(record.Accuracyradius))
+	str("address_class", record.Addressclass)
+	str("net_speed", record.Netspeed)
+	str("idd_code", record.Iddcode)
+	str("area_code", record.Areacode)
+	str("weather_station_code", record.Weatherstationcode)
+	str("weather_station_name", record.Weatherstationname)
+	str("mcc", record.Mcc)
+	str("mnc", record.Mnc)
+	str("mobile_brand", record.Mobilebrand)
+	num("elevation", float64(record.Elevation))
+	str("usage_type", record.Usagetype)
+	str("address_type", record.Addresstype)
+	str("category", record.Category)
+	str("district", record.District)
+	if record.Geofences != "" {
+		fields["geofences"] = strings.Split(record.Geofences, ",")
+	}
+	return fields
+}
+
+// addProxyFields adds the IP2Proxy fields of record to fields.
+func addProxyFields(fields map[string]interface{}, record IP2Proxyrecord) {
+	if record.Isproxy < 0 {
+		return
+	}
+	fields["is_proxy"] = int(record.Isproxy)
+	for name, value := range map[string]string{
+		"proxy_type":      record.Proxytype,
+		"proxy_provider":  record.Provider,
+		"proxy_threat":    record.Threat,
+		"proxy_last_seen": record.Lastseen,
+	} {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+}
+
+// serveGeoEndpoint answers a request for the geo endpoint with the record of
+// the client IP, or of the ?ip= address when the client may look up others.
+func (g *GeoIP) serveGeoEndpoint(rw http.ResponseWriter, req *http.Request, client net.IP) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		rw.Header().Set("Allow", "GET, HEAD")
+		writeJSON(rw, http.StatusMethodNotAllowed, map[string]interface{}{"error": "method not allowed"})
+		return
+	}
+	if client == nil {
+		writeJSON(rw, http.StatusBadRequest, map[string]interface{}{"error": "could not determine client IP"})
+		return
+	}
+
+	ip := client
+	if query := req.URL.Query().Get("ip"); query != "" {
+		if !g.geoEndpointAllows(client) {
+			writeJSON(rw, http.StatusForbidden, map[string]interface{}{"error": "lookups of other addresses are not allowed"})
+			return
+		}
+		if ip = net.ParseIP(query); ip == nil {
+			writeJSON(rw, http.StatusBadRequest, map[string]interface{}{"error": "invalid ip"})
+			return
+		}
+	}
+
+	record, err := g.lookup(ip)
+	if err != nil {
+		log.Printf("[%s] geo endpoint lookup of %s failed: %v", g.name, ip, err)
+		writeJSON(rw, http.StatusInternalServerError, map[string]interface{}{"ip": ip.String(), "error": "lookup failed"})
+		return
+	}
+
+	fields := recordFields(record)
+	if g.proxyDB != nil {
+		if proxyRecord, err := g.proxyDB.Get_all(ip.String()); err == nil {
+			addProxyFields(fields, proxyRecord)
+		}
+	}
+	fields["ip"] = ip.String()
+	writeJSON(rw, http.StatusOK, fields)
+}
+
+// geoEndpointAllows reports whether client may look up other addresses.
+func (g *GeoIP) geoEndpointAllows(client net.IP) bool {
+	for _, n := range g.geoEndpointAllowed {
+		if n.Contains(client) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON writes v as the JSON body of a response that must not be cached,
+// since it depends on the client address.
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(status)
+	_, _ = rw.Write(body)
+}
@@ -0,0 +1,176 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGeoIP_GeoEndpoint(t *testing.T) {
+	dbPath := buildTestBIN(t, 11, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{
+			"country_short": "GB",
+			"country_long":  "United Kingdom",
+			"city":          "London",
+			"latitude":      "51.5142",
+		}},
+		{from: "81.2.70.0", fields: map[string]string{"country_short": "DE"}},
+		{from: "81.2.71.0"},
+	})
+
+	handler, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Errorf("request for %s reached the backend", req.URL)
+	}), &Config{
+		Filename:                dbPath,
+		GeoEndpoint:             "/.well-known/geo",
+		GeoEndpointAllowedCIDRs: []string{"81.2.69.0/24"},
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		remote string
+		status int
+		want   map[string]interface{}
+	}{
+		{
+			name:   "own record",
+			target: "/.well-known/geo",
+			remote: "81.2.69.160:1234",
+			status: http.StatusOK,
+			want: map[string]interface{}{
+				"ip":             "81.2.69.160",
+				"country_code":   "GB",
+				"country_name":   "United Kingdom",
+				"city":           "London",
+				"continent_code": "EU",
+				"address_class":  "public",
+			},
+		},
+		{
+			name:   "other address from allowed client",
+			target: "/.well-known/geo?ip=81.2.70.1",
+			remote: "81.2.69.160:1234",
+			status: http.StatusOK,
+			want:   map[string]interface{}{"ip": "81.2.70.1", "country_code": "DE"},
+		},
+		{
+			name:   "other address from other client",
+			target: "/.well-known/geo?ip=81.2.69.160",
+			remote: "81.2.70.1:1234",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "invalid address",
+			target: "/.well-known/geo?ip=nope",
+			remote: "81.2.69.160:1234",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "wrong method",
+			method: http.MethodPost,
+			target: "/.well-known/geo",
+			remote: "81.2.69.160:1234",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		method := tt.method
+		if method == "" {
+			method = http.MethodGet
+		}
+		req := httptest.NewRequest(method, "http://localhost"+tt.target, nil)
+		req.RemoteAddr = tt.remote
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		if rw.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rw.Code, tt.status)
+			continue
+		}
+		if got := rw.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("%s: Content-Type = %q", tt.name, got)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s: invalid JSON body %q: %v", tt.name, rw.Body.String(), err)
+			continue
+		}
+		for key, want := range tt.want {
+			if body[key] != want {
+				t.Errorf("%s: %s = %v, want %v", tt.name, key, body[key], want)
+			}
+		}
+		if tt.status == http.StatusOK && body["latitude"] == nil && tt.want["city"] != nil {
+			t.Errorf("%s: latitude missing", tt.name)
+		}
+	}
+
+	// other paths are passed on
+	var reached bool
+	handler, err = New(context.Background(), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		reached = true
+	}), &Config{Filename: dbPath, GeoEndpoint: "/.well-known/geo"}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/.well-known/geo/x", nil)
+	req.RemoteAddr = "81.2.69.160:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !reached {
+		t.Error("expected other paths to reach the backend")
+	}
+}
+
+func TestGeoIP_GeoEndpointPolicy(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.70.0", fields: map[string]string{"country_short": "RU"}},
+		{from: "81.2.71.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:         dbPath,
+		GeoEndpoint:      "/geo",
+		BlockedCountries: []string{"RU"},
+		RateLimits:       map[string]string{"country:GB": "1/1m"},
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remote string
+		status int
+	}{
+		{"81.2.70.1:1234", http.StatusForbidden},
+		{"81.2.69.1:1234", http.StatusOK},
+		{"81.2.69.1:1234", http.StatusTooManyRequests},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/geo", nil)
+		req.RemoteAddr = tt.remote
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		if rw.Code != tt.status {
+			t.Errorf("request %d from %s: status = %d, want %d", i+1, tt.remote, rw.Code, tt.status)
+		}
+	}
+}
+
+func TestGeoIP_InvalidGeoEndpoint(t *testing.T) {
+	for _, config := range []*Config{
+		{Filename: "IP2LOCATION-LITE-DB1.BIN", GeoEndpoint: "geo"},
+		{Filename: "IP2LOCATION-LITE-DB1.BIN", GeoEndpoint: "/geo", GeoEndpointAllowedCIDRs: []string{"10.0.0.0/40"}},
+	} {
+		if _, err := New(context.Background(), &httpHandlerMock{}, config, "test"); err == nil {
+			t.Errorf("Expected error for geo_endpoint %q with %v", config.GeoEndpoint, config.GeoEndpointAllowedCIDRs)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package traefik_plugin_ip2location
+
+import "strings"
+
+// netspeedConnectionTypes maps IP2Location net speed codes to the MaxMind
+// connection_type vocabulary.
+var netspeedConnectionTypes = map[string]string{
+	"DIAL": "Dialup",
+	"DSL":  "Cable/DSL",
+	"COMP": "Corporate",
+	"T1":   "Corporate",
+	"SAT":  "Satellite",
+}
+
+// usagetypeUserTypes maps IP2Location usage type codes to the MaxMind
+// user_type vocabulary.
+var usagetypeUserTypes = map[string]string{
+	"COM": "business",
+	"ORG": "business",
+	"GOV": "government",
+	"MIL": "military",
+	"EDU": "college",
+	"LIB": "library",
+	"CDN": "content_delivery_network",
+	"ISP": "residential",
+	"MOB": "cellular",
+	"DCH": "hosting",
+	"SES": "search_engine_spider",
+	"RSV": "reserved",
+}
+
+// connectionTypeOf returns the connection type for an IP2Location net speed.
+// Values that are not IP2Location codes (e.g. from an MMDB file) are returned as is.
+func connectionTypeOf(netspeed string) string {
+	if v, ok := netspeedConnectionTypes[strings.ToUpper(netspeed)]; ok {
+		return v
+	}
+	return netspeed
+}
+
+// userTypeOf returns the user type for an IP2Location usage type. Combined
+// codes such as "ISP/MOB" resolve to cellular when MOB is present, otherwise
+// to the first code. Values that are not IP2Location codes are returned as is.
+func userTypeOf(usagetype string) string {
+	if usagetype == "" {
+		return ""
+	}
+	codes := strings.Split(strings.ToUpper(usagetype), "/")
+	for _, code := range codes {
+		if code == "MOB" {
+			return usagetypeUserTypes[code]
+		}
+	}
+	if v, ok := usagetypeUserTypes[codes[0]]; ok {
+		return v
+	}
+	return usagetype
+}
@@ -0,0 +1,124 @@
+package traefik_plugin_ip2location
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// parseForwarded parses RFC 7239 Forwarded header values and returns the
+// "for" node of every hop, nearest to the client first. A hop without a
+// "for" parameter yields an empty node. Multiple header lines are treated
+// as one comma separated list.
+func parseForwarded(values []string) ([]string, error) {
+	var nodes []string
+	for _, value := range values {
+		elements, err := splitQuoted(value, ',')
+		if err != nil {
+			return nil, err
+		}
+		for _, element := range elements {
+			if strings.TrimSpace(element) == "" {
+				continue
+			}
+			node, err := forwardedFor(element)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// forwardedFor returns the unquoted "for" value of one forwarded-element.
+func forwardedFor(element string) (string, error) {
+	pairs, err := splitQuoted(element, ';')
+	if err != nil {
+		return "", err
+	}
+	node := ""
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		eq := strings.IndexByte(pair, '=')
+		if eq <= 0 {
+			return "", fmt.Errorf("invalid Forwarded parameter %q", pair)
+		}
+		if !strings.EqualFold(strings.TrimSpace(pair[:eq]), "for") {
+			continue
+		}
+		value, err := unquote(strings.TrimSpace(pair[eq+1:]))
+		if err != nil {
+			return "", err
+		}
+		node = value
+	}
+	return node, nil
+}
+
+// splitQuoted splits s at sep, ignoring separators inside quoted strings.
+func splitQuoted(s string, sep byte) ([]string, error) {
+	var parts []string
+	start := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quoted string in %q", s)
+	}
+	return append(parts, s[start:]), nil
+}
+
+// unquote returns the value of a token or quoted-string.
+func unquote(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+		return "", fmt.Errorf("invalid quoted string %q", s)
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), nil
+}
+
+// forwardedNodeIP returns the IP of a Forwarded node such as "192.0.2.43",
+// "192.0.2.43:47011" or "[2001:db8::1]:443". Obfuscated identifiers
+// ("_hidden") and "unknown" have no IP and return nil.
+func forwardedNodeIP(node string) net.IP {
+	if node == "" || node[0] == '_' || strings.EqualFold(node, "unknown") {
+		return nil
+	}
+	if node[0] == '[' {
+		end := strings.IndexByte(node, ']')
+		if end < 0 {
+			return nil
+		}
+		return net.ParseIP(node[1:end])
+	}
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(node)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
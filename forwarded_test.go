@@ -0,0 +1,100 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseForwarded(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{"token", []string{"for=192.0.2.60;proto=http;by=203.0.113.43"}, []string{"192.0.2.60"}},
+		{"quoted ipv6", []string{`for="[2001:db8:cafe::17]:4711"`}, []string{"[2001:db8:cafe::17]:4711"}},
+		{"case insensitive", []string{"For=192.0.2.60"}, []string{"192.0.2.60"}},
+		{"multiple hops", []string{"for=192.0.2.43, for=198.51.100.17"}, []string{"192.0.2.43", "198.51.100.17"}},
+		{"multiple lines", []string{"for=192.0.2.43", "for=198.51.100.17;by=_proxy"}, []string{"192.0.2.43", "198.51.100.17"}},
+		{"obfuscated", []string{"for=_hidden, for=unknown"}, []string{"_hidden", "unknown"}},
+		{"no for", []string{"proto=https, for=192.0.2.1"}, []string{"", "192.0.2.1"}},
+		{"separators in quotes", []string{`for="_a,b;c", for=192.0.2.1`}, []string{"_a,b;c", "192.0.2.1"}},
+		{"escaped quote", []string{`for="_a\"b"`}, []string{`_a"b`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseForwarded(tt.values)
+			if err != nil {
+				t.Fatalf("parseForwarded failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseForwarded = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, value := range []string{`for="192.0.2.1`, "for", "=192.0.2.1"} {
+		if _, err := parseForwarded([]string{value}); err == nil {
+			t.Errorf("parseForwarded(%q) expected error", value)
+		}
+	}
+}
+
+func TestForwardedNodeIP(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.43":               "192.0.2.43",
+		"192.0.2.43:47011":         "192.0.2.43",
+		"[2001:db8:cafe::17]":      "2001:db8:cafe::17",
+		"[2001:db8:cafe::17]:4711": "2001:db8:cafe::17",
+		"2001:db8::1":              "2001:db8::1",
+		"_hidden":                  "<nil>",
+		"unknown":                  "<nil>",
+		"[2001:db8::1":             "<nil>",
+		"":                         "<nil>",
+	}
+	for node, want := range tests {
+		if got := forwardedNodeIP(node).String(); got != want {
+			t.Errorf("forwardedNodeIP(%q) = %s, want %s", node, got, want)
+		}
+	}
+}
+
+func TestGeoIP_Forwarded(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.70.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:     dbPath,
+		CountryCode:  "X-Country-Code",
+		ClientIp:     "X-Client-Addr",
+		UseForwarded: true,
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		forwarded string
+		want      string
+	}{
+		{`for="81.2.69.160:443";proto=https, for=10.0.0.2`, "81.2.69.160"},
+		{`for="[::ffff:81.2.69.161]:443";proto=https`, "81.2.69.161"},
+		{"for=_hidden, for=81.2.69.160", "10.0.0.1"},
+		{`for="81.2.69.160`, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("Forwarded", tt.forwarded)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got := req.Header.Get("X-Client-Addr"); got != tt.want {
+			t.Errorf("Forwarded %q: client IP = %q, want %q", tt.forwarded, got, tt.want)
+		}
+	}
+}
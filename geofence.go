@@ -0,0 +1,191 @@
+package traefik_plugin_ip2location
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// geofence is a named area made of one or more polygons. Each polygon is a
+// list of rings, the first being the outer boundary and the others holes.
+// Points are [longitude, latitude] as in GeoJSON.
+type geofence struct {
+	name     string
+	polygons [][][][2]float64
+	// bounding box, to skip most fences without testing the polygons
+	minLon, minLat, maxLon, maxLat float64
+}
+
+// geofenceSet is a loaded geofence file, in file order.
+type geofenceSet struct {
+	fences []*geofence
+}
+
+// geoJSON holds the parts of GeoJSON objects used for geofences.
+type geoJSON struct {
+	Type        string                 `json:"type"`
+	Features    []geoJSON              `json:"features"`
+	Geometry    *geoJSON               `json:"geometry"`
+	Properties  map[string]interface{} `json:"properties"`
+	Coordinates json.RawMessage        `json:"coordinates"`
+}
+
+// loadGeofences reads a GeoJSON FeatureCollection or Feature whose features
+// are Polygons or MultiPolygons named by their "name" property.
+func loadGeofences(path string) (*geofenceSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var root geoJSON
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var features []geoJSON
+	switch root.Type {
+	case "FeatureCollection":
+		features = root.Features
+	case "Feature":
+		features = []geoJSON{root}
+	default:
+		return nil, fmt.Errorf("%s: expected a FeatureCollection or Feature, got %q", path, root.Type)
+	}
+
+	set := &geofenceSet{}
+	seen := map[string]bool{}
+	for i, feature := range features {
+		fence, err := newGeofence(feature)
+		if err != nil {
+			return nil, fmt.Errorf("%s: feature %d: %w", path, i, err)
+		}
+		if seen[fence.name] {
+			return nil, fmt.Errorf("%s: feature %d: duplicate name %q", path, i, fence.name)
+		}
+		seen[fence.name] = true
+		set.fences = append(set.fences, fence)
+	}
+	return set, nil
+}
+
+func newGeofence(feature geoJSON) (*geofence, error) {
+	name, _ := feature.Properties["name"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("missing name property")
+	}
+	if strings.Contains(name, ",") {
+		return nil, fmt.Errorf("name %q contains a comma", name)
+	}
+	if feature.Geometry == nil {
+		return nil, fmt.Errorf("%s: missing geometry", name)
+	}
+
+	var polygons [][][][]float64
+	var err error
+	switch feature.Geometry.Type {
+	case "Polygon":
+		var polygon [][][]float64
+		err = json.Unmarshal(feature.Geometry.Coordinates, &polygon)
+		polygons = [][][][]float64{polygon}
+	case "MultiPolygon":
+		err = json.Unmarshal(feature.Geometry.Coordinates, &polygons)
+	default:
+		return nil, fmt.Errorf("%s: unsupported geometry type %q, use Polygon or MultiPolygon", name, feature.Geometry.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid coordinates: %w", name, err)
+	}
+
+	fence := &geofence{name: name, minLon: math.Inf(1), minLat: math.Inf(1), maxLon: math.Inf(-1), maxLat: math.Inf(-1)}
+	for _, polygon := range polygons {
+		if len(polygon) == 0 {
+			return nil, fmt.Errorf("%s: polygon without rings", name)
+		}
+		var rings [][][2]float64
+		for _, ring := range polygon {
+			if len(ring) < 4 {
+				return nil, fmt.Errorf("%s: a ring needs at least 4 positions", name)
+			}
+			points := make([][2]float64, len(ring))
+			for i, position := range ring {
+				if len(position) < 2 {
+					return nil, fmt.Errorf("%s: position with less than 2 coordinates", name)
+				}
+				points[i] = [2]float64{position[0], position[1]}
+				fence.minLon = math.Min(fence.minLon, position[0])
+				fence.maxLon = math.Max(fence.maxLon, position[0])
+				fence.minLat = math.Min(fence.minLat, position[1])
+				fence.maxLat = math.Max(fence.maxLat, position[1])
+			}
+			rings = append(rings, points)
+		}
+		fence.polygons = append(fence.polygons, rings)
+	}
+	if len(fence.polygons) == 0 {
+		return nil, fmt.Errorf("%s: no polygons", name)
+	}
+	return fence, nil
+}
+
+// has reports whether the set contains a fence called name.
+func (s *geofenceSet) has(name string) bool {
+	for _, f := range s.fences {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the names of the fences containing the point.
+func (s *geofenceSet) match(lat, lon float64) []string {
+	var names []string
+	for _, f := range s.fences {
+		if f.contains(lon, lat) {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// contains reports whether the point is inside one of the polygons of f and
+// outside its holes.
+func (f *geofence) contains(lon, lat float64) bool {
+	if lon < f.minLon || lon > f.maxLon || lat < f.minLat || lat > f.maxLat {
+		return false
+	}
+	for _, rings := range f.polygons {
+		if !pointInRing(rings[0], lon, lat) {
+			continue
+		}
+		inHole := false
+		for _, hole := range rings[1:] {
+			if pointInRing(hole, lon, lat) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// pointInRing tests the point against a closed ring with the even-odd rule,
+// casting a ray in the direction of increasing x.
+func pointInRing(ring [][2]float64, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
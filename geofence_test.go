@@ -0,0 +1,175 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testGeofences has a square around central London with a hole over the
+// City, a multipolygon covering parts of Paris and Berlin, and a box over the
+// south of England.
+const testGeofences = `{
+  "type": "FeatureCollection",
+  "features": [
+    {
+      "type": "Feature",
+      "properties": {"name": "london"},
+      "geometry": {
+        "type": "Polygon",
+        "coordinates": [
+          [[-0.3, 51.4], [0.1, 51.4], [0.1, 51.6], [-0.3, 51.6], [-0.3, 51.4]],
+          [[-0.11, 51.50], [-0.07, 51.50], [-0.07, 51.52], [-0.11, 51.52], [-0.11, 51.50]]
+        ]
+      }
+    },
+    {
+      "type": "Feature",
+      "properties": {"name": "delivery-zone"},
+      "geometry": {
+        "type": "MultiPolygon",
+        "coordinates": [
+          [[[2.2, 48.8], [2.5, 48.8], [2.5, 48.9], [2.2, 48.9], [2.2, 48.8]]],
+          [[[13.3, 52.4], [13.5, 52.4], [13.4, 52.6], [13.3, 52.4]]]
+        ]
+      }
+    },
+    {
+      "type": "Feature",
+      "properties": {"name": "uk-south"},
+      "geometry": {
+        "type": "Polygon",
+        "coordinates": [[[-6, 50], [2, 50], [2, 52], [-6, 52], [-6, 50]]]
+      }
+    }
+  ]
+}`
+
+func writeGeofences(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fences.geojson")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write geofence file: %v", err)
+	}
+	return path
+}
+
+func TestLoadGeofences(t *testing.T) {
+	set, err := loadGeofences(writeGeofences(t, testGeofences))
+	if err != nil {
+		t.Fatalf("loadGeofences failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     []string
+	}{
+		{"Westminster", 51.4995, -0.1248, []string{"london", "uk-south"}},
+		{"City hole", 51.5155, -0.0922, []string{"uk-south"}},
+		{"Paris", 48.8566, 2.3522, []string{"delivery-zone"}},
+		{"Berlin triangle", 52.45, 13.4, []string{"delivery-zone"}},
+		{"outside Berlin triangle", 52.55, 13.32, nil},
+		{"Madrid", 40.4168, -3.7038, nil},
+	}
+	for _, tt := range tests {
+		if got := set.match(tt.lat, tt.lon); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadGeofences_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"not JSON":      `{`,
+		"wrong type":    `{"type": "Polygon", "coordinates": []}`,
+		"no name":       `{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,0],[1,1],[0,0]]]}}`,
+		"comma in name": `{"type": "Feature", "properties": {"name": "a,b"}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,0],[1,1],[0,0]]]}}`,
+		"point":         `{"type": "Feature", "properties": {"name": "a"}, "geometry": {"type": "Point", "coordinates": [0,0]}}`,
+		"short ring":    `{"type": "Feature", "properties": {"name": "a"}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,0],[0,0]]]}}`,
+		"duplicate": `{"type": "FeatureCollection", "features": [
+			{"type": "Feature", "properties": {"name": "a"}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,0],[1,1],[0,0]]]}},
+			{"type": "Feature", "properties": {"name": "a"}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,0],[1,1],[0,0]]]}}]}`,
+	}
+	for name, content := range tests {
+		if _, err := loadGeofences(writeGeofences(t, content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestGeoIP_Geofences(t *testing.T) {
+	dbPath := buildTestBIN(t, 5, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB", "latitude": "51.4995", "longitude": "-0.1248"}},
+		{from: "81.2.70.0", fields: map[string]string{"country_short": "GB", "latitude": "50.8225", "longitude": "-0.1372"}},
+		{from: "81.2.71.0", fields: map[string]string{"country_short": "GB", "latitude": "53.4808", "longitude": "-2.2426"}},
+		{from: "81.2.72.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.73.0"},
+	})
+	fencePath := writeGeofences(t, testGeofences)
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:         dbPath,
+		GeofenceFilename: fencePath,
+		Geofences:        "X-Geofences",
+		AllowedGeofences: []string{"uk-south"},
+		BlockedGeofences: []string{"london"},
+		FailClosed:       true,
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remote string
+		status int
+		fences string
+	}{
+		{"81.2.69.1:1234", http.StatusForbidden, ""},  // London is blocked
+		{"81.2.70.1:1234", http.StatusOK, "uk-south"}, // Brighton
+		{"81.2.71.1:1234", http.StatusForbidden, ""},  // Manchester is in no allowed fence
+		{"81.2.72.1:1234", http.StatusForbidden, ""},  // no coordinates, fail closed
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.RemoteAddr = tt.remote
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		if rw.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.remote, rw.Code, tt.status)
+		}
+		if got := req.Header.Get("X-Geofences"); got != tt.fences {
+			t.Errorf("%s: X-Geofences = %q, want %q", tt.remote, got, tt.fences)
+		}
+	}
+
+	// without a policy the header lists every matching fence
+	handler, err = New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:         dbPath,
+		GeofenceFilename: fencePath,
+		Geofences:        "X-Geofences",
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.RemoteAddr = "81.2.69.1:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got := req.Header.Get("X-Geofences"); got != "london,uk-south" {
+		t.Errorf("X-Geofences = %q, want london,uk-south", got)
+	}
+
+	for _, config := range []*Config{
+		{Filename: dbPath, Geofences: "X-Geofences"},
+		{Filename: dbPath, AllowedGeofences: []string{"london"}},
+		{Filename: dbPath, GeofenceFilename: fencePath, BlockedGeofences: []string{"paris"}},
+	} {
+		if _, err := New(context.Background(), &httpHandlerMock{}, config, "test"); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package traefik_plugin_ip2location
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// geoFieldNames lists the keys recordFields and addProxyFields may set, plus
+// the client IP.
+var geoFieldNames = map[string]bool{
+	"ip": true, "country_code": true, "country_name": true, "region": true, "region_code": true,
+	"city": true, "postal_code": true, "latitude": true, "longitude": true, "timezone": true,
+	"timezone_name": true, "continent_code": true, "continent_name": true, "isp": true, "asn": true,
+	"asn_organization": true, "domain": true, "connection_type": true, "user_type": true, "accuracy_radius": true,
+	"address_class": true, "net_speed": true, "idd_code": true, "area_code": true,
+	"weather_station_code": true, "weather_station_name": true, "mcc": true, "mnc": true,
+	"mobile_brand": true, "elevation": true, "usage_type": true, "address_type": true,
+	"category": true, "district": true, "is_proxy": true, "proxy_type": true,
+	"proxy_provider": true, "proxy_threat": true, "proxy_last_seen": true, "geofences": true,
+}
+
+// geoHeader writes the whole record, or a subset of its fields, into a single
+// header as JSON.
+type geoHeader struct {
+	name string
+	// base64 encodes the JSON as unpadded base64url
+	base64 bool
+	// fields is the subset of keys to include, nil for all
+	fields map[string]bool
+}
+
+// newGeoHeader builds the single geo header from the configuration. It
+// returns nil when geo_header is not set.
+func newGeoHeader(config *Config) (*geoHeader, error) {
+	if config.GeoHeader == "" {
+		return nil, nil
+	}
+
+	h := &geoHeader{name: config.GeoHeader}
+	switch strings.ToLower(config.GeoHeaderEncoding) {
+	case "", "json":
+	case "base64":
+		h.base64 = true
+	default:
+		return nil, fmt.Errorf("invalid geo_header_encoding %q, must be json or base64", config.GeoHeaderEncoding)
+	}
+
+	if len(config.GeoHeaderFields) > 0 {
+		h.fields = make(map[string]bool, len(config.GeoHeaderFields))
+		for _, field := range config.GeoHeaderFields {
+			field = strings.ToLower(strings.TrimSpace(field))
+			if !geoFieldNames[field] {
+				return nil, fmt.Errorf("unknown field %q in geo_header_fields", field)
+			}
+			h.fields[field] = true
+		}
+	}
+	return h, nil
+}
+
+// value returns the header value for the client ip, its record and, when
+// looked up, its IP2Proxy record.
+func (h *geoHeader) value(ip net.IP, record IP2Locationrecord, proxyRecord *IP2Proxyrecord) (string, error) {
+	fields := recordFields(record)
+	if proxyRecord != nil {
+		addProxyFields(fields, *proxyRecord)
+	}
+	if ip != nil {
+		fields["ip"] = ip.String()
+	}
+	if h.fields != nil {
+		for name := range fields {
+			if !h.fields[name] {
+				delete(fields, name)
+			}
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	if h.base64 {
+		return base64.RawURLEncoding.EncodeToString(data), nil
+	}
+	return string(data), nil
+}
+
+// set adds the header to header.
+func (h *geoHeader) set(header http.Header, ip net.IP, record IP2Locationrecord, proxyRecord *IP2Proxyrecord) error {
+	v, err := h.value(ip, record, proxyRecord)
+	if err != nil {
+		return err
+	}
+	header.Set(h.name, v)
+	return nil
+}
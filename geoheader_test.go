@@ -0,0 +1,100 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGeoHeader_Value(t *testing.T) {
+	record := IP2Locationrecord{Country_short: "GB", City: "London", Latitude: 51.5, Usagetype: "ISP/MOB"}
+	proxy := &IP2Proxyrecord{Isproxy: 1, Proxytype: "VPN"}
+
+	h, err := newGeoHeader(&Config{GeoHeader: "X-Geo"})
+	if err != nil {
+		t.Fatalf("newGeoHeader failed: %v", err)
+	}
+	got, err := h.value(net.ParseIP("81.2.69.160"), record, proxy)
+	if err != nil {
+		t.Fatalf("value failed: %v", err)
+	}
+	want := `{"city":"London","country_code":"GB","ip":"81.2.69.160","is_proxy":1,"latitude":51.5,"proxy_type":"VPN","usage_type":"ISP/MOB","user_type":"cellular"}`
+	if got != want {
+		t.Errorf("value = %s, want %s", got, want)
+	}
+
+	h, err = newGeoHeader(&Config{GeoHeader: "X-Geo", GeoHeaderEncoding: "base64", GeoHeaderFields: []string{"country_code", " City "}})
+	if err != nil {
+		t.Fatalf("newGeoHeader failed: %v", err)
+	}
+	got, err = h.value(net.ParseIP("81.2.69.160"), record, proxy)
+	if err != nil {
+		t.Fatalf("value failed: %v", err)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(got)
+	if err != nil {
+		t.Fatalf("value %q is not base64url: %v", got, err)
+	}
+	if string(data) != `{"city":"London","country_code":"GB"}` {
+		t.Errorf("decoded value = %s", data)
+	}
+
+	for _, config := range []*Config{
+		{GeoHeader: "X-Geo", GeoHeaderEncoding: "hex"},
+		{GeoHeader: "X-Geo", GeoHeaderFields: []string{"country"}},
+	} {
+		if _, err := newGeoHeader(config); err == nil {
+			t.Errorf("expected error for %+v", config)
+		}
+	}
+	if h, err := newGeoHeader(&Config{}); h != nil || err != nil {
+		t.Errorf("newGeoHeader without geo_header = %v, %v", h, err)
+	}
+}
+
+func TestGeoIP_GeoHeader(t *testing.T) {
+	dbPath := buildTestBIN(t, 3, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{
+			"country_short": "GB",
+			"country_long":  "United Kingdom",
+			"city":          "London",
+		}},
+		{from: "81.2.70.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:        dbPath,
+		GeoHeader:       "X-Geo",
+		GeoHeaderFields: []string{"ip", "country_code", "city"},
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.RemoteAddr = "81.2.69.160:1234"
+	req.Header.Set("X-Geo", `{"country_code":"US"}`)
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(req.Header.Get("X-Geo")), &fields); err != nil {
+		t.Fatalf("X-Geo %q is not JSON: %v", req.Header.Get("X-Geo"), err)
+	}
+	want := map[string]string{"ip": "81.2.69.160", "country_code": "GB", "city": "London"}
+	if len(fields) != len(want) {
+		t.Errorf("X-Geo = %v, want %v", fields, want)
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("X-Geo %s = %q, want %q", k, fields[k], v)
+		}
+	}
+	if got := rw.Header().Get("X-Geo"); got != "" {
+		t.Errorf("X-Geo response header = %q, want it only on the request", got)
+	}
+}
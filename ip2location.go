@@ -3,18 +3,27 @@ package traefik_plugin_ip2location
 import (
 	"context"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Config the plugin configuration (flattened for Traefik Yaegi compatibility).
 type Config struct {
-	Filename           string   `json:"filename,omitempty" yaml:"filename,omitempty"`
-	FromHeader         string   `json:"from_header,omitempty" yaml:"from_header,omitempty"`
-	ClientIp           string   `json:"client_ip,omitempty" yaml:"client_ip,omitempty"`
-	
+	Filename          string `json:"filename,omitempty" yaml:"filename,omitempty"`
+	AsnFilename       string `json:"asn_filename,omitempty" yaml:"asn_filename,omitempty"`
+	ProxyFilename     string `json:"proxy_filename,omitempty" yaml:"proxy_filename,omitempty"`
+	OverridesFilename string `json:"overrides_filename,omitempty" yaml:"overrides_filename,omitempty"`
+	ReloadInterval    string `json:"reload_interval,omitempty" yaml:"reload_interval,omitempty"`
+	InMemory          bool   `json:"in_memory,omitempty" yaml:"in_memory,omitempty"`
+	CacheSize         int    `json:"cache_size,omitempty" yaml:"cache_size,omitempty"`
+	CacheTTL          string `json:"cache_ttl,omitempty" yaml:"cache_ttl,omitempty"`
+	FromHeader        string `json:"from_header,omitempty" yaml:"from_header,omitempty"`
+	ClientIp          string `json:"client_ip,omitempty" yaml:"client_ip,omitempty"`
+
 	// Header mappings - flattened (no nested struct for Yaegi compatibility)
 	CountryCode     string `json:"country_code,omitempty" yaml:"country_code,omitempty"`
 	CountryName     string `json:"country_name,omitempty" yaml:"country_name,omitempty"`
@@ -34,81 +43,383 @@ type Config struct {
 	ConnectionType  string `json:"connection_type,omitempty" yaml:"connection_type,omitempty"`
 	UserType        string `json:"user_type,omitempty" yaml:"user_type,omitempty"`
 	AccuracyRadius  string `json:"accuracy_radius,omitempty" yaml:"accuracy_radius,omitempty"`
+	AddressClass    string `json:"address_class,omitempty" yaml:"address_class,omitempty"`
+	// Country code reported for private, reserved and other special-purpose addresses
+	SpecialCountryCode string `json:"special_country_code,omitempty" yaml:"special_country_code,omitempty"`
+	// IP2Location specific fields (availability depends on the BIN database type)
+	NetSpeed           string `json:"net_speed,omitempty" yaml:"net_speed,omitempty"`
+	IddCode            string `json:"idd_code,omitempty" yaml:"idd_code,omitempty"`
+	AreaCode           string `json:"area_code,omitempty" yaml:"area_code,omitempty"`
+	WeatherStationCode string `json:"weather_station_code,omitempty" yaml:"weather_station_code,omitempty"`
+	WeatherStationName string `json:"weather_station_name,omitempty" yaml:"weather_station_name,omitempty"`
+	Mcc                string `json:"mcc,omitempty" yaml:"mcc,omitempty"`
+	Mnc                string `json:"mnc,omitempty" yaml:"mnc,omitempty"`
+	MobileBrand        string `json:"mobile_brand,omitempty" yaml:"mobile_brand,omitempty"`
+	Elevation          string `json:"elevation,omitempty" yaml:"elevation,omitempty"`
+	UsageType          string `json:"usage_type,omitempty" yaml:"usage_type,omitempty"`
+	AddressType        string `json:"address_type,omitempty" yaml:"address_type,omitempty"`
+	Category           string `json:"category,omitempty" yaml:"category,omitempty"`
+	District           string `json:"district,omitempty" yaml:"district,omitempty"`
+	// IP2Proxy fields (requires proxy_filename)
+	ProxyType     string `json:"proxy_type,omitempty" yaml:"proxy_type,omitempty"`
+	ProxyProvider string `json:"proxy_provider,omitempty" yaml:"proxy_provider,omitempty"`
+	ProxyThreat   string `json:"proxy_threat,omitempty" yaml:"proxy_threat,omitempty"`
+	ProxyLastSeen string `json:"proxy_last_seen,omitempty" yaml:"proxy_last_seen,omitempty"`
+	IsProxy       string `json:"is_proxy,omitempty" yaml:"is_proxy,omitempty"`
 	// Legacy fields for backward compatibility
 	CountryShort string `json:"country_short,omitempty" yaml:"country_short,omitempty"`
 	CountryLong  string `json:"country_long,omitempty" yaml:"country_long,omitempty"`
 	Zipcode      string `json:"zipcode,omitempty" yaml:"zipcode,omitempty"`
-	
-	DisableErrorHeader bool     `json:"disable_error_header,omitempty" yaml:"disable_error_header,omitempty"`
-	UseXForwardedFor   bool     `json:"use_x_forwarded_for,omitempty" yaml:"use_x_forwarded_for,omitempty"`
-	UseXRealIP         bool     `json:"use_x_real_ip,omitempty" yaml:"use_x_real_ip,omitempty"`
-	UseXClientIP       bool     `json:"use_x_client_ip,omitempty" yaml:"use_x_client_ip,omitempty"`
-	TrustedProxies     []string `json:"trusted_proxies,omitempty" yaml:"trusted_proxies,omitempty"`
+
+	DisableErrorHeader bool `json:"disable_error_header,omitempty" yaml:"disable_error_header,omitempty"`
+	// Where lookup errors are reported: client, upstream and/or log
+	ErrorTargets []string `json:"error_targets,omitempty" yaml:"error_targets,omitempty"`
+	// Field options whose headers are set on the request (all when empty) and the response (none when empty)
+	RequestFields    []string `json:"request_fields,omitempty" yaml:"request_fields,omitempty"`
+	ResponseFields   []string `json:"response_fields,omitempty" yaml:"response_fields,omitempty"`
+	StrictFields     bool     `json:"strict_fields,omitempty" yaml:"strict_fields,omitempty"`
+	UseXForwardedFor bool     `json:"use_x_forwarded_for,omitempty" yaml:"use_x_forwarded_for,omitempty"`
+	UseXRealIP       bool     `json:"use_x_real_ip,omitempty" yaml:"use_x_real_ip,omitempty"`
+	UseXClientIP     bool     `json:"use_x_client_ip,omitempty" yaml:"use_x_client_ip,omitempty"`
+	UseForwarded     bool     `json:"use_forwarded,omitempty" yaml:"use_forwarded,omitempty"`
+	IPSources        []string `json:"ip_sources,omitempty" yaml:"ip_sources,omitempty"`
+	TrustedProxies   []string `json:"trusted_proxies,omitempty" yaml:"trusted_proxies,omitempty"`
+	TrustedHops      int      `json:"trusted_hops,omitempty" yaml:"trusted_hops,omitempty"`
+	// StrictTrustedProxies makes an empty TrustedProxies list trust nobody
+	StrictTrustedProxies bool     `json:"strict_trusted_proxies,omitempty" yaml:"strict_trusted_proxies,omitempty"`
+	StripHeaderPrefix    []string `json:"strip_header_prefix,omitempty" yaml:"strip_header_prefix,omitempty"`
+
+	// JSON lookup endpoint - enabled when the path is set
+	GeoEndpoint             string   `json:"geo_endpoint,omitempty" yaml:"geo_endpoint,omitempty"`
+	GeoEndpointAllowedCIDRs []string `json:"geo_endpoint_allowed_cidrs,omitempty" yaml:"geo_endpoint_allowed_cidrs,omitempty"`
+
+	// Single header holding the record as JSON - enabled when the name is set
+	GeoHeader         string   `json:"geo_header,omitempty" yaml:"geo_header,omitempty"`
+	GeoHeaderEncoding string   `json:"geo_header_encoding,omitempty" yaml:"geo_header_encoding,omitempty"`
+	GeoHeaderFields   []string `json:"geo_header_fields,omitempty" yaml:"geo_header_fields,omitempty"`
+
+	// HMAC signature over the request headers set by the plugin - enabled when the name is set
+	SignatureHeader string `json:"signature_header,omitempty" yaml:"signature_header,omitempty"`
+	SignatureSecret string `json:"signature_secret,omitempty" yaml:"signature_secret,omitempty"`
+
+	// Country blocking - enabled when any of the lists is set
+	AllowedCountries  []string          `json:"allowed_countries,omitempty" yaml:"allowed_countries,omitempty"`
+	BlockedCountries  []string          `json:"blocked_countries,omitempty" yaml:"blocked_countries,omitempty"`
+	AllowedContinents []string          `json:"allowed_continents,omitempty" yaml:"allowed_continents,omitempty"`
+	BlockedContinents []string          `json:"blocked_continents,omitempty" yaml:"blocked_continents,omitempty"`
+	FailClosed        bool              `json:"fail_closed,omitempty" yaml:"fail_closed,omitempty"`
+	BlockStatusCode   int               `json:"block_status_code,omitempty" yaml:"block_status_code,omitempty"`
+	BlockBody         string            `json:"block_body,omitempty" yaml:"block_body,omitempty"`
+	BlockHeaders      map[string]string `json:"block_headers,omitempty" yaml:"block_headers,omitempty"`
+
+	// Geofences - GeoJSON polygons matched against the client coordinates
+	GeofenceFilename string   `json:"geofence_filename,omitempty" yaml:"geofence_filename,omitempty"`
+	Geofences        string   `json:"geofences,omitempty" yaml:"geofences,omitempty"`
+	AllowedGeofences []string `json:"allowed_geofences,omitempty" yaml:"allowed_geofences,omitempty"`
+	BlockedGeofences []string `json:"blocked_geofences,omitempty" yaml:"blocked_geofences,omitempty"`
+
+	// Geo redirects - enabled when any redirect is set
+	Redirects            map[string]string `json:"redirects,omitempty" yaml:"redirects,omitempty"`
+	RedirectStatusCode   int               `json:"redirect_status_code,omitempty" yaml:"redirect_status_code,omitempty"`
+	RedirectOptOutCookie string            `json:"redirect_opt_out_cookie,omitempty" yaml:"redirect_opt_out_cookie,omitempty"`
+	RedirectOptOutQuery  string            `json:"redirect_opt_out_query,omitempty" yaml:"redirect_opt_out_query,omitempty"`
+
+	// Rate limiting per country, ASN or usage type - enabled when any limit is set
+	RateLimits          map[string]string `json:"rate_limits,omitempty" yaml:"rate_limits,omitempty"`
+	RateLimitMaxBuckets int               `json:"rate_limit_max_buckets,omitempty" yaml:"rate_limit_max_buckets,omitempty"`
+
+	// Distance to configured sites, name -> "latitude,longitude"
+	Sites               map[string]string `json:"sites,omitempty" yaml:"sites,omitempty"`
+	NearestSite         string            `json:"nearest_site,omitempty" yaml:"nearest_site,omitempty"`
+	NearestSiteDistance string            `json:"nearest_site_distance,omitempty" yaml:"nearest_site_distance,omitempty"`
+	SiteDistance        string            `json:"site_distance,omitempty" yaml:"site_distance,omitempty"`
+
+	// IANA time zone resolved from the country and coordinates
+	TimezoneName string `json:"timezone_name,omitempty" yaml:"timezone_name,omitempty"`
+	UtcOffset    string `json:"utc_offset,omitempty" yaml:"utc_offset,omitempty"`
+	LocalTime    string `json:"local_time,omitempty" yaml:"local_time,omitempty"`
 }
 
 // CreateConfig creates the default plugin configuration.
 func CreateConfig() *Config {
 	return &Config{
-		UseXForwardedFor: true,
-		UseXRealIP:       true,
-		UseXClientIP:     true,
+		UseXForwardedFor:     true,
+		UseXRealIP:           true,
+		UseXClientIP:         true,
+		StrictTrustedProxies: true,
 	}
 }
 
-// GeoIP plugin using IP2Location BIN database (no external dependencies).
+// GeoIP plugin using an IP2Location BIN or MaxMind MMDB database (no external dependencies).
 type GeoIP struct {
-	next               http.Handler
-	name               string
-	fromHeader         string
-	clientIp           string
-	db                 *DB
+	next      http.Handler
+	name      string
+	clientIp  string
+	db        Locator
+	asnDB     Locator
+	proxyDB   proxyLocator
+	overrides overrideLookup
 	// Header mappings - flattened
 	countryCode        string
-	countryName         string
-	region              string
-	regionCode          string
-	city                string
-	postalCode          string
-	latitude            string
-	longitude           string
-	timezone            string
-	continentCode       string
-	continentName       string
-	isp                 string
-	asn                 string
-	asnOrganization     string
-	domain              string
-	connectionType      string
-	userType            string
-	accuracyRadius      string
+	countryName        string
+	region             string
+	regionCode         string
+	city               string
+	postalCode         string
+	latitude           string
+	longitude          string
+	timezone           string
+	continentCode      string
+	continentName      string
+	isp                string
+	asn                string
+	asnOrganization    string
+	domain             string
+	connectionType     string
+	userType           string
+	accuracyRadius     string
+	addressClass       string
+	specialCountryCode string
+	// IP2Location specific fields
+	netSpeed           string
+	iddCode            string
+	areaCode           string
+	weatherStationCode string
+	weatherStationName string
+	mcc                string
+	mnc                string
+	mobileBrand        string
+	elevation          string
+	usageType          string
+	addressType        string
+	category           string
+	district           string
+	// Distance to the configured sites
+	sites               []site
+	nearestSite         string
+	nearestSiteDistance string
+	siteDistance        string
+	geofences           string
+	// IANA time zone of the client
+	timezoneName string
+	utcOffset    string
+	localTime    string
+	now          func() time.Time
+	// resolveTimezone is set when a header or the endpoint uses the zone name
+	resolveTimezone bool
+	// IP2Proxy fields
+	proxyType     string
+	proxyProvider string
+	proxyThreat   string
+	proxyLastSeen string
+	isProxy       string
 	// Legacy fields
-	countryShort        string
-	countryLong         string
-	zipcode             string
-	disableErrorHeader  bool
-	useXForwardedFor    bool
-	useXRealIP          bool
-	useXClientIP        bool
-	trustedProxies      []*net.IPNet
+	countryShort       string
+	countryLong        string
+	zipcode            string
+	disableErrorHeader bool
+	errorClient        bool
+	errorUpstream      bool
+	errorLog           bool
+	// copies of the plugin restricted to request_fields and response_fields,
+	// responseHeaders is nil when no field goes to the response
+	requestHeaders     *GeoIP
+	responseHeaders    *GeoIP
+	ipSources          []ipSource
+	trustedProxies     []*net.IPNet
+	strictProxies      bool
+	trustedHops        int
+	policy             *countryPolicy
+	geofenceSet        *geofenceSet
+	redirect           *geoRedirect
+	rateLimiter        *rateLimiter
+	cache              *lookupCache
+	stripHeaders       []string
+	stripPrefixes      []string
+	geoEndpoint        string
+	geoEndpointAllowed []*net.IPNet
+	geoHeader          *geoHeader
+	signer             *signer
 }
 
 // New creates a new GeoIP plugin.
-func New(_ context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
 	if config.Filename == "" {
 		return nil, fmt.Errorf("filename is required")
 	}
 
-	db, err := OpenDB(config.Filename)
+	var reloadInterval time.Duration
+	if config.ReloadInterval != "" {
+		var err error
+		reloadInterval, err = time.ParseDuration(config.ReloadInterval)
+		if err != nil || reloadInterval < 0 {
+			return nil, fmt.Errorf("invalid reload_interval %q", config.ReloadInterval)
+		}
+	}
+
+	sources, err := ipSources(config)
 	if err != nil {
-		return nil, fmt.Errorf("error opening IP2Location database file: %w", err)
+		return nil, err
+	}
+
+	trustedProxies, err := parseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.GeoEndpoint != "" && !strings.HasPrefix(config.GeoEndpoint, "/") {
+		return nil, fmt.Errorf("invalid geo_endpoint %q, must be a path starting with /", config.GeoEndpoint)
+	}
+	geoEndpointAllowed, err := parseIPRanges("geo_endpoint_allowed_cidrs", config.GeoEndpointAllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	geoHeader, err := newGeoHeader(config)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := newSigner(config)
+	if err != nil {
+		return nil, err
+	}
+
+	errorTargets := map[string]bool{"upstream": true}
+	if len(config.ErrorTargets) > 0 {
+		errorTargets = map[string]bool{}
+		for _, target := range config.ErrorTargets {
+			target = strings.ToLower(strings.TrimSpace(target))
+			if target != "client" && target != "upstream" && target != "log" {
+				return nil, fmt.Errorf("invalid error_targets entry %q, must be client, upstream or log", target)
+			}
+			errorTargets[target] = true
+		}
+	}
+
+	var requestFields, responseFields map[string]bool
+	if len(config.RequestFields) > 0 {
+		if requestFields, err = parseFieldOptions("request_fields", config.RequestFields); err != nil {
+			return nil, err
+		}
+	}
+	if len(config.ResponseFields) > 0 {
+		if responseFields, err = parseFieldOptions("response_fields", config.ResponseFields); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.TrustedHops < 0 {
+		return nil, fmt.Errorf("invalid trusted_hops %d", config.TrustedHops)
+	}
+
+	if config.CacheSize < 0 {
+		return nil, fmt.Errorf("invalid cache_size %d", config.CacheSize)
+	}
+	var cacheTTL time.Duration
+	if config.CacheTTL != "" {
+		var err error
+		cacheTTL, err = time.ParseDuration(config.CacheTTL)
+		if err != nil || cacheTTL < 0 {
+			return nil, fmt.Errorf("invalid cache_ttl %q", config.CacheTTL)
+		}
+	}
+
+	policy, err := newCountryPolicy(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var fences *geofenceSet
+	if config.GeofenceFilename != "" {
+		if fences, err = loadGeofences(config.GeofenceFilename); err != nil {
+			return nil, fmt.Errorf("error loading geofence file: %w", err)
+		}
+	}
+	for _, names := range [][]string{config.AllowedGeofences, config.BlockedGeofences} {
+		for _, name := range names {
+			if fences == nil || !fences.has(strings.TrimSpace(name)) {
+				return nil, fmt.Errorf("unknown geofence %q in allowed_geofences or blocked_geofences", name)
+			}
+		}
+	}
+	if config.Geofences != "" && fences == nil {
+		return nil, fmt.Errorf("geofences requires geofence_filename")
+	}
+
+	redirect, err := newGeoRedirect(config)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimiter, err := newRateLimiter(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sites, err := parseSites(config.Sites)
+	if err != nil {
+		return nil, err
+	}
+	if len(sites) == 0 && (config.NearestSite != "" || config.NearestSiteDistance != "" || config.SiteDistance != "") {
+		return nil, fmt.Errorf("nearest_site, nearest_site_distance and site_distance require sites")
+	}
+	if config.UtcOffset != "" || config.LocalTime != "" {
+		if err := checkZoneinfo(); err != nil {
+			return nil, err
+		}
+	}
+	// the zone name is only resolved when a header or the endpoint uses it
+	resolveTimezone := config.TimezoneName != "" || config.UtcOffset != "" || config.LocalTime != "" ||
+		config.GeoEndpoint != "" || (geoHeader != nil && (geoHeader.fields == nil || geoHeader.fields["timezone_name"]))
+
+	db, err := OpenDatabase(config.Filename, config.InMemory)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database file: %w", err)
+	}
+
+	var asnDB Locator
+	if config.AsnFilename != "" {
+		asnDB, err = OpenDatabase(config.AsnFilename, config.InMemory)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error opening ASN database file: %w", err)
+		}
+	}
+
+	var proxyDB *ProxyDB
+	if config.ProxyFilename != "" {
+		proxyDB, err = openProxyDB(config.ProxyFilename, config.InMemory)
+		if err != nil {
+			db.Close()
+			if asnDB != nil {
+				asnDB.Close()
+			}
+			return nil, fmt.Errorf("error opening IP2Proxy database file: %w", err)
+		}
+	}
+
+	var overrides *overrideTable
+	if config.OverridesFilename != "" {
+		overrides, err = loadOverrides(config.OverridesFilename)
+		if err != nil {
+			db.Close()
+			if asnDB != nil {
+				asnDB.Close()
+			}
+			if proxyDB != nil {
+				proxyDB.Close()
+			}
+			return nil, fmt.Errorf("error loading overrides file: %w", err)
+		}
 	}
 
 	plugin := &GeoIP{
-		next:               next,
-		name:               name,
-		fromHeader:         config.FromHeader,
-		clientIp:           config.ClientIp,
-		db:                 db,
+		next:     next,
+		name:     name,
+		clientIp: config.ClientIp,
+		db:       db,
+		asnDB:    asnDB,
 		// Header mappings - flattened
 		countryCode:        config.CountryCode,
 		countryName:        config.CountryName,
@@ -128,144 +439,618 @@ func New(_ context.Context, next http.Handler, config *Config, name string) (htt
 		connectionType:     config.ConnectionType,
 		userType:           config.UserType,
 		accuracyRadius:     config.AccuracyRadius,
+		addressClass:       config.AddressClass,
+		specialCountryCode: config.SpecialCountryCode,
+		// IP2Location specific fields
+		netSpeed:           config.NetSpeed,
+		iddCode:            config.IddCode,
+		areaCode:           config.AreaCode,
+		weatherStationCode: config.WeatherStationCode,
+		weatherStationName: config.WeatherStationName,
+		mcc:                config.Mcc,
+		mnc:                config.Mnc,
+		mobileBrand:        config.MobileBrand,
+		elevation:          config.Elevation,
+		usageType:          config.UsageType,
+		addressType:        config.AddressType,
+		category:           config.Category,
+		district:           config.District,
+		// Distance to the configured sites
+		sites:               sites,
+		nearestSite:         config.NearestSite,
+		nearestSiteDistance: config.NearestSiteDistance,
+		siteDistance:        config.SiteDistance,
+		geofences:           config.Geofences,
+		// IANA time zone of the client
+		timezoneName:    config.TimezoneName,
+		utcOffset:       config.UtcOffset,
+		localTime:       config.LocalTime,
+		now:             time.Now,
+		resolveTimezone: resolveTimezone,
+		// IP2Proxy fields
+		proxyType:     config.ProxyType,
+		proxyProvider: config.ProxyProvider,
+		proxyThreat:   config.ProxyThreat,
+		proxyLastSeen: config.ProxyLastSeen,
+		isProxy:       config.IsProxy,
 		// Legacy fields
 		countryShort:       config.CountryShort,
 		countryLong:        config.CountryLong,
 		zipcode:            config.Zipcode,
 		disableErrorHeader: config.DisableErrorHeader,
-		useXForwardedFor:   config.UseXForwardedFor,
-		useXRealIP:         config.UseXRealIP,
-		useXClientIP:       config.UseXClientIP,
-	}
-
-
-	// Parse trusted proxy CIDR ranges
-	if len(config.TrustedProxies) > 0 {
-		plugin.trustedProxies = make([]*net.IPNet, 0, len(config.TrustedProxies))
-		for _, proxy := range config.TrustedProxies {
-			_, ipNet, err := net.ParseCIDR(proxy)
-			if err != nil {
-				// Try parsing as single IP
-				ip := net.ParseIP(proxy)
-				if ip == nil {
-					continue
+		errorClient:        errorTargets["client"],
+		errorUpstream:      errorTargets["upstream"],
+		errorLog:           errorTargets["log"],
+		ipSources:          sources,
+		trustedProxies:     trustedProxies,
+		strictProxies:      config.StrictTrustedProxies,
+		trustedHops:        config.TrustedHops,
+		policy:             policy,
+		geofenceSet:        fences,
+		redirect:           redirect,
+		rateLimiter:        rateLimiter,
+		geoEndpoint:        config.GeoEndpoint,
+		geoEndpointAllowed: geoEndpointAllowed,
+		geoHeader:          geoHeader,
+		signer:             signer,
+	}
+
+	// Only BIN files declare their columns up front, MMDB records are free-form.
+	if bin, ok := db.(*DB); ok {
+		if missing := plugin.unavailableFields(bin); len(missing) > 0 {
+			if config.StrictFields {
+				db.Close()
+				if asnDB != nil {
+					asnDB.Close()
 				}
-				// Create a /32 or /128 CIDR for single IP
-				if ip.To4() != nil {
-					_, ipNet, _ = net.ParseCIDR(ip.String() + "/32")
-				} else {
-					_, ipNet, _ = net.ParseCIDR(ip.String() + "/128")
+				if proxyDB != nil {
+					proxyDB.Close()
 				}
+				return nil, fmt.Errorf("fields not available in IP2Location database type %d: %s", bin.meta.databasetype, strings.Join(missing, ", "))
 			}
-			plugin.trustedProxies = append(plugin.trustedProxies, ipNet)
+			log.Printf("[%s] fields not available in IP2Location database type %d, their headers will never be set: %s", name, bin.meta.databasetype, strings.Join(missing, ", "))
 		}
 	}
 
+	if proxyDB != nil {
+		plugin.proxyDB = proxyDB
+	}
+	if overrides != nil {
+		plugin.overrides = overrides
+	}
+
+	plugin.stripHeaders = plugin.outputHeaders()
+	plugin.requestHeaders = plugin.withFields(requestFields)
+	if len(config.ResponseFields) > 0 {
+		plugin.responseHeaders = plugin.withFields(responseFields)
+	}
+	for _, entry := range config.StripHeaderPrefix {
+		prefix := strings.TrimSuffix(strings.TrimSpace(entry), "*")
+		if prefix == "" {
+			return nil, fmt.Errorf("invalid strip_header_prefix %q", entry)
+		}
+		plugin.stripPrefixes = append(plugin.stripPrefixes, strings.ToLower(prefix))
+	}
+
+	if config.CacheSize > 0 {
+		plugin.cache = newLookupCache(config.CacheSize, cacheTTL)
+		go func() {
+			<-ctx.Done()
+			hits, misses := plugin.cache.stats()
+			log.Printf("[%s] lookup cache: %d hits, %d misses", name, hits, misses)
+		}()
+	}
+
+	// Watch the database files and swap in new versions without a restart.
+	if reloadInterval > 0 {
+		var reloaders []*reloader
+
+		reloadable := newReloadableDB(name, config.Filename, db, config.InMemory)
+		plugin.db = reloadable
+		reloaders = append(reloaders, reloadable.reloader)
+
+		if asnDB != nil {
+			reloadable := newReloadableDB(name, config.AsnFilename, asnDB, config.InMemory)
+			plugin.asnDB = reloadable
+			reloaders = append(reloaders, reloadable.reloader)
+		}
+		if proxyDB != nil {
+			reloadable := newReloadableProxyDB(name, config.ProxyFilename, proxyDB, config.InMemory)
+			plugin.proxyDB = reloadable
+			reloaders = append(reloaders, reloadable.reloader)
+		}
+		if plugin.cache != nil {
+			for _, r := range reloaders {
+				r.onSwap = plugin.cache.purge
+			}
+		}
+
+		go watch(ctx, reloadInterval, reloaders)
+	}
+
+	// The overrides file is edited by hand, so it is watched even without
+	// reload_interval.
+	if overrides != nil {
+		interval := reloadInterval
+		if interval == 0 {
+			interval = overridesReloadInterval
+		}
+		reloadable := newReloadableOverrides(name, config.OverridesFilename, overrides)
+		plugin.overrides = reloadable
+		if plugin.cache != nil {
+			reloadable.onSwap = plugin.cache.purge
+		}
+		go watch(ctx, interval, []*reloader{reloadable.reloader})
+	}
+
 	return plugin, nil
 }
 
+// unavailableFields returns the configured field options that the opened BIN
+// database type does not contain.
+func (g *GeoIP) unavailableFields(db *DB) []string {
+	var missing []string
+	check := func(option, header string, enabled bool) {
+		if header != "" && !enabled {
+			missing = append(missing, option)
+		}
+	}
+
+	check("country_code", g.countryCode, db.country_enabled)
+	check("country_name", g.countryName, db.country_enabled)
+	check("country_short", g.countryShort, db.country_enabled)
+	check("country_long", g.countryLong, db.country_enabled)
+	check("continent_code", g.continentCode, db.country_enabled)
+	check("continent_name", g.continentName, db.country_enabled)
+	check("region", g.region, db.region_enabled)
+	check("region_code", g.regionCode, false)
+	check("city", g.city, db.city_enabled)
+	check("postal_code", g.postalCode, db.zipcode_enabled)
+	check("zipcode", g.zipcode, db.zipcode_enabled)
+	check("latitude", g.latitude, db.latitude_enabled)
+	check("longitude", g.longitude, db.longitude_enabled)
+	check("timezone", g.timezone, db.timezone_enabled)
+	check("accuracy_radius", g.accuracyRadius, false)
+	check("isp", g.isp, db.isp_enabled)
+	check("domain", g.domain, db.domain_enabled)
+	check("asn", g.asn, db.asn_enabled || g.asnDB != nil)
+	check("asn_organization", g.asnOrganization, db.as_enabled || g.asnDB != nil)
+	check("connection_type", g.connectionType, db.netspeed_enabled)
+	check("user_type", g.userType, db.usagetype_enabled)
+	check("net_speed", g.netSpeed, db.netspeed_enabled)
+	check("idd_code", g.iddCode, db.iddcode_enabled)
+	check("area_code", g.areaCode, db.areacode_enabled)
+	check("weather_station_code", g.weatherStationCode, db.weatherstationcode_enabled)
+	check("weather_station_name", g.weatherStationName, db.weatherstationname_enabled)
+	check("mcc", g.mcc, db.mcc_enabled)
+	check("mnc", g.mnc, db.mnc_enabled)
+	check("mobile_brand", g.mobileBrand, db.mobilebrand_enabled)
+	check("elevation", g.elevation, db.elevation_enabled)
+	check("usage_type", g.usageType, db.usagetype_enabled)
+	check("address_type", g.addressType, db.addresstype_enabled)
+	check("category", g.category, db.category_enabled)
+	check("district", g.district, db.district_enabled)
+	check("nearest_site", g.nearestSite, db.latitude_enabled)
+	check("nearest_site_distance", g.nearestSiteDistance, db.latitude_enabled)
+	check("site_distance", g.siteDistance, db.latitude_enabled)
+	check("geofences", g.geofences, db.latitude_enabled)
+	check("timezone_name", g.timezoneName, db.country_enabled)
+	check("utc_offset", g.utcOffset, db.country_enabled)
+	check("local_time", g.localTime, db.country_enabled)
+
+	return missing
+}
+
 func (g *GeoIP) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	ip, err := g.getIP(req)
+
+	// Values sent by the client must never reach the backend as ours.
+	g.removeClientHeaders(req.Header)
+
+	// The geo endpoint is subject to the policy and the rate limits like
+	// any other path.
+	endpoint := g.geoEndpoint != "" && req.URL.Path == g.geoEndpoint
+
+	if err == nil && ip == nil {
+		err = fmt.Errorf("could not determine client IP")
+	}
 	if err != nil {
-		if !g.disableErrorHeader {
-			req.Header.Set("X-GEOIP-ERROR", err.Error())
-			rw.Header().Set("X-GEOIP-ERROR", err.Error())
+		if endpoint && (g.policy == nil || !g.policy.failClosed) {
+			log.Printf("[%s] geo endpoint: %v", g.name, err)
+			g.serveGeoEndpoint(rw, req, nil)
+			return
 		}
-		g.next.ServeHTTP(rw, req)
+		g.serveUnresolved(rw, req, err.Error())
 		return
 	}
 
-	if ip == nil {
-		if !g.disableErrorHeader {
-			req.Header.Set("X-GEOIP-ERROR", "could not determine client IP")
-			rw.Header().Set("X-GEOIP-ERROR", "could not determine client IP")
+	record, err := g.lookup(ip)
+	if err != nil {
+		if endpoint && (g.policy == nil || !g.policy.failClosed) {
+			// answers with the lookup error
+			g.serveGeoEndpoint(rw, req, ip)
+			return
 		}
-		g.next.ServeHTTP(rw, req)
+		g.serveUnresolved(rw, req, fmt.Sprintf("database lookup failed: %v", err))
 		return
 	}
 
-	record, err := g.db.Get_all(ip.String())
-	if err != nil {
-		if !g.disableErrorHeader {
-			errorMsg := fmt.Sprintf("database lookup failed: %v", err)
-			req.Header.Set("X-GEOIP-ERROR", errorMsg)
-			rw.Header().Set("X-GEOIP-ERROR", errorMsg)
+	located := record.Latitude != 0 || record.Longitude != 0
+	if g.policy != nil && (!g.policy.allows(record.Country_short, record.Continentcode) || !g.policy.allowsGeofences(record.Geofences, located)) {
+		g.policy.reject(rw)
+		return
+	}
+
+	if g.rateLimiter != nil {
+		if ok, wait := g.rateLimiter.allow(record); !ok {
+			g.rateLimiter.reject(rw, wait)
+			return
 		}
-		g.next.ServeHTTP(rw, req)
+	}
+
+	if endpoint {
+		g.serveGeoEndpoint(rw, req, ip)
+		return
+	}
+
+	if g.redirect != nil && g.redirect.serve(rw, req, record) {
 		return
 	}
 
 	// Add headers to request (for backend services)
-	g.addHeaders(req, ip, record)
+	g.requestHeaders.addHeaders(req, ip, record)
+
+	// Only the fields selected by response_fields go to the client
+	if g.responseHeaders != nil {
+		g.responseHeaders.addResponseHeaders(rw, ip, record)
+	}
+
+	var proxy *IP2Proxyrecord
+	if g.proxyDB != nil {
+		proxyRecord, err := g.proxyDB.Get_all(ip.String())
+		if err != nil {
+			g.setErrorHeader(rw, req, fmt.Sprintf("proxy lookup failed: %v", err))
+		} else {
+			g.requestHeaders.addProxyHeaders(req.Header, proxyRecord)
+			if g.responseHeaders != nil {
+				g.responseHeaders.addProxyHeaders(rw.Header(), proxyRecord)
+			}
+			proxy = &proxyRecord
+		}
+	}
 
-	// Also add headers to response (for client)
-	g.addResponseHeaders(rw, ip, record)
+	// The combined header is only sent to the backend.
+	if g.geoHeader != nil {
+		if err := g.geoHeader.set(req.Header, ip, record, proxy); err != nil {
+			g.setErrorHeader(rw, req, fmt.Sprintf("encoding %s failed: %v", g.geoHeader.name, err))
+		}
+	}
+
+	if g.signer != nil {
+		g.signer.sign(req.Header, ip, g.stripHeaders)
+	}
 
 	g.next.ServeHTTP(rw, req)
 }
 
-// getIP extracts the client IP address from the request.
-// Priority order:
-// 1. Custom header (if configured)
-// 2. X-Real-IP (if enabled and trusted)
-// 3. X-Client-IP (if enabled and trusted)
-// 4. X-Forwarded-For (if enabled and trusted)
-// 5. RemoteAddr
-func (g *GeoIP) getIP(req *http.Request) (net.IP, error) {
-	// Priority 1: Custom header
-	if g.fromHeader != "" {
-		ipStr := req.Header.Get(g.fromHeader)
-		if ipStr != "" {
-			ip := g.parseIP(ipStr)
-			if ip != nil {
-				return ip, nil
-			}
+// outputHeaders returns every header name the plugin may set on a request.
+func (g *GeoIP) outputHeaders() []string {
+	names := []string{
+		"X-GEOIP-ERROR",
+		g.clientIp,
+		g.countryCode,
+		g.countryName,
+		g.region,
+		g.regionCode,
+		g.city,
+		g.postalCode,
+		g.latitude,
+		g.longitude,
+		g.timezone,
+		g.continentCode,
+		g.continentName,
+		g.isp,
+		g.asn,
+		g.asnOrganization,
+		g.domain,
+		g.connectionType,
+		g.userType,
+		g.accuracyRadius,
+		g.addressClass,
+		g.netSpeed,
+		g.iddCode,
+		g.areaCode,
+		g.weatherStationCode,
+		g.weatherStationName,
+		g.mcc,
+		g.mnc,
+		g.mobileBrand,
+		g.elevation,
+		g.usageType,
+		g.addressType,
+		g.category,
+		g.district,
+		g.proxyType,
+		g.proxyProvider,
+		g.proxyThreat,
+		g.proxyLastSeen,
+		g.isProxy,
+		g.countryShort,
+		g.countryLong,
+		g.zipcode,
+	}
+	if g.geoHeader != nil {
+		names = append(names, g.geoHeader.name)
+	}
+	if g.signer != nil {
+		names = append(names, g.signer.header)
+	}
+	names = append(names, g.nearestSite, g.nearestSiteDistance, g.geofences, g.timezoneName, g.utcOffset, g.localTime)
+	if g.siteDistance != "" {
+		for _, s := range g.sites {
+			names = append(names, g.siteDistance+s.name)
 		}
 	}
+	headers := names[:0]
+	for _, name := range names {
+		if name != "" {
+			headers = append(headers, name)
+		}
+	}
+	return headers
+}
 
-	// Check if we should trust proxy headers
-	trustProxy := g.isTrustedProxy(req.RemoteAddr)
+// headerOptions returns the header name fields of g by field option.
+func (g *GeoIP) headerOptions() map[string]*string {
+	return map[string]*string{
+		"client_ip":             &g.clientIp,
+		"country_code":          &g.countryCode,
+		"country_name":          &g.countryName,
+		"region":                &g.region,
+		"region_code":           &g.regionCode,
+		"city":                  &g.city,
+		"postal_code":           &g.postalCode,
+		"latitude":              &g.latitude,
+		"longitude":             &g.longitude,
+		"timezone":              &g.timezone,
+		"continent_code":        &g.continentCode,
+		"continent_name":        &g.continentName,
+		"isp":                   &g.isp,
+		"asn":                   &g.asn,
+		"asn_organization":      &g.asnOrganization,
+		"domain":                &g.domain,
+		"connection_type":       &g.connectionType,
+		"user_type":             &g.userType,
+		"accuracy_radius":       &g.accuracyRadius,
+		"address_class":         &g.addressClass,
+		"net_speed":             &g.netSpeed,
+		"idd_code":              &g.iddCode,
+		"area_code":             &g.areaCode,
+		"weather_station_code":  &g.weatherStationCode,
+		"weather_station_name":  &g.weatherStationName,
+		"mcc":                   &g.mcc,
+		"mnc":                   &g.mnc,
+		"mobile_brand":          &g.mobileBrand,
+		"elevation":             &g.elevation,
+		"usage_type":            &g.usageType,
+		"address_type":          &g.addressType,
+		"category":              &g.category,
+		"district":              &g.district,
+		"nearest_site":          &g.nearestSite,
+		"nearest_site_distance": &g.nearestSiteDistance,
+		"site_distance":         &g.siteDistance,
+		"geofences":             &g.geofences,
+		"timezone_name":         &g.timezoneName,
+		"utc_offset":            &g.utcOffset,
+		"local_time":            &g.localTime,
+		"proxy_type":            &g.proxyType,
+		"proxy_provider":        &g.proxyProvider,
+		"proxy_threat":          &g.proxyThreat,
+		"proxy_last_seen":       &g.proxyLastSeen,
+		"is_proxy":              &g.isProxy,
+		"country_short":         &g.countryShort,
+		"country_long":          &g.countryLong,
+		"zipcode":               &g.zipcode,
+	}
+}
 
-	// Priority 2: X-Real-IP
-	if g.useXRealIP && trustProxy {
-		ipStr := req.Header.Get("X-Real-IP")
-		if ipStr != "" {
-			ip := g.parseIP(ipStr)
-			if ip != nil {
-				return ip, nil
-			}
+// parseFieldOptions parses a list of field options, returning nil when it
+// contains "all".
+func parseFieldOptions(option string, fields []string) (map[string]bool, error) {
+	known := (&GeoIP{}).headerOptions()
+	set := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "all" {
+			return nil, nil
 		}
+		if _, ok := known[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q in %s", field, option)
+		}
+		set[field] = true
 	}
+	return set, nil
+}
 
-	// Priority 3: X-Client-IP
-	if g.useXClientIP && trustProxy {
-		ipStr := req.Header.Get("X-Client-IP")
-		if ipStr != "" {
-			ip := g.parseIP(ipStr)
-			if ip != nil {
-				return ip, nil
-			}
+// withFields returns a copy of g that only sets the headers of the field
+// options in fields, or g itself when fields is nil.
+func (g *GeoIP) withFields(fields map[string]bool) *GeoIP {
+	if fields == nil {
+		return g
+	}
+	c := *g
+	for option, header := range c.headerOptions() {
+		if !fields[option] {
+			*header = ""
 		}
 	}
+	return &c
+}
 
-	// Priority 4: X-Forwarded-For
-	if g.useXForwardedFor && trustProxy {
-		xff := req.Header.Get("X-Forwarded-For")
-		if xff != "" {
-			// X-Forwarded-For can contain multiple IPs, take the first one
-			ips := strings.Split(xff, ",")
-			if len(ips) > 0 {
-				ipStr := strings.TrimSpace(ips[0])
-				ip := g.parseIP(ipStr)
-				if ip != nil {
-					return ip, nil
-				}
+// removeClientHeaders deletes the output headers, and any header matching a
+// strip prefix, from the incoming request.
+func (g *GeoIP) removeClientHeaders(header http.Header) {
+	for _, name := range g.stripHeaders {
+		header.Del(name)
+	}
+	if len(g.stripPrefixes) == 0 {
+		return
+	}
+	for name := range header {
+		lower := strings.ToLower(name)
+		for _, prefix := range g.stripPrefixes {
+			if strings.HasPrefix(lower, prefix) {
+				delete(header, name)
+				break
 			}
 		}
 	}
+}
 
-	// Priority 4: RemoteAddr
-	addr, _, err := net.SplitHostPort(req.RemoteAddr)
+// setErrorHeader reports msg to the configured error targets, in the
+// X-GEOIP-ERROR header of the request and the response unless disabled.
+func (g *GeoIP) setErrorHeader(rw http.ResponseWriter, req *http.Request, msg string) {
+	if g.errorLog {
+		log.Printf("[%s] %s", g.name, msg)
+	}
+	if g.disableErrorHeader {
+		return
+	}
+	if g.errorUpstream {
+		req.Header.Set("X-GEOIP-ERROR", msg)
+	}
+	if g.errorClient {
+		rw.Header().Set("X-GEOIP-ERROR", msg)
+	}
+}
+
+// serveUnresolved handles requests whose location could not be determined:
+// they are rejected when the country policy fails closed, otherwise passed on.
+func (g *GeoIP) serveUnresolved(rw http.ResponseWriter, req *http.Request, msg string) {
+	g.setErrorHeader(rw, req, msg)
+	if g.policy != nil && g.policy.failClosed {
+		g.policy.reject(rw)
+		return
+	}
+	if g.signer != nil {
+		g.signer.sign(req.Header, nil, g.stripHeaders)
+	}
+	g.next.ServeHTTP(rw, req)
+}
+
+// lookup queries the database for ip and fills in the fields that are derived
+// from the record or from the secondary ASN database.
+func (g *GeoIP) lookup(ip net.IP) (IP2Locationrecord, error) {
+	// Addresses with a static override bypass the cache, as a cached range
+	// may span the overridden prefix.
+	var ov *override
+	if g.overrides != nil {
+		ov = g.overrides.lookup(ip)
+	}
+
+	// Special-purpose addresses are classified before the cache is
+	// consulted, as a cached public range may span them too.
+	class := addressClassOf(ip)
+	cached := ov == nil && class == addressClassPublic && g.cache != nil
+
+	var gen uint64
+	if cached {
+		gen = g.cache.generation()
+		if record, ok := g.cache.get(ip); ok {
+			return record, nil
+		}
+	}
+
+	record, r, err := g.query(ip, class)
+	if err != nil {
+		return record, err
+	}
+	if ov != nil {
+		ov.apply(&record)
+	}
+
+	if record.Continentcode == "" {
+		record.Continentcode, record.Continentname = continentOf(record.Country_short)
+	} else if record.Continentname == "" {
+		record.Continentname = continentNames[record.Continentcode]
+	}
+
+	if g.geofenceSet != nil && (record.Latitude != 0 || record.Longitude != 0) {
+		record.Geofences = strings.Join(g.geofenceSet.match(float64(record.Latitude), float64(record.Longitude)), ",")
+	}
+
+	if g.resolveTimezone {
+		record.Timezonename = timezoneNameOf(record)
+	}
+
+	if cached {
+		g.cache.add(ip, record, r, gen)
+	}
+	return record, nil
+}
+
+// query looks ip, of the given address class, up in the databases, together
+// with the range of addresses sharing the result. Special-purpose addresses
+// are not in the databases and get the placeholder country instead.
+func (g *GeoIP) query(ip net.IP, class string) (IP2Locationrecord, ipRange, error) {
+	if class != addressClassPublic {
+		return IP2Locationrecord{Country_short: g.specialCountryCode, Addressclass: class}, ipRange{}, nil
+	}
+
+	record, r, err := getAllRange(g.db, ip.String())
+	if err != nil {
+		return record, r, err
+	}
+
+	// The ASN database is optional enrichment, a failed lookup there
+	// should not discard the geolocation data.
+	if g.asnDB != nil && (record.Asn == "" || record.Asn == "-") {
+		asnRecord, asnRange, err := getAllRange(g.asnDB, ip.String())
+		if err == nil {
+			record.Asn = asnRecord.Asn
+			record.As = asnRecord.As
+		}
+		// the result is only shared by addresses in both ranges
+		r = r.intersect(asnRange)
+	}
+
+	record.Addressclass = addressClassPublic
+	return record, r, nil
+}
+
+// getIP extracts the client IP address from the request by trying the
+// configured sources in order. Sources that require a trusted proxy are
+// skipped when the peer is not one. The default chain is:
+// 1. Custom header (if configured)
+// 2. X-Real-IP (if enabled and trusted)
+// 3. X-Client-IP (if enabled and trusted)
+// 4. Forwarded (if enabled and trusted)
+// 5. X-Forwarded-For (if enabled and trusted)
+// 6. RemoteAddr
+func (g *GeoIP) getIP(req *http.Request) (net.IP, error) {
+	trustProxy := g.isTrustedProxy(req.RemoteAddr)
+	// Without a trusted_proxies list the hop count is what protects the
+	// proxy chains, so the peer is trusted for them even in strict mode.
+	trustChain := trustProxy || (g.trustedHops > 0 && len(g.trustedProxies) == 0)
+
+	for _, src := range g.ipSources {
+		chain := src.kind == sourceList || src.kind == sourceForwarded
+		if src.trusted && !trustProxy && !(chain && trustChain) {
+			continue
+		}
+		if src.kind == sourceRemoteAddr {
+			return remoteAddrIP(req.RemoteAddr)
+		}
+		if ip := g.ipFromSource(req, src); ip != nil {
+			return ip, nil
+		}
+	}
+	return nil, nil
+}
+
+// remoteAddrIP returns the IP of the connecting peer.
+func remoteAddrIP(remoteAddr string) (net.IP, error) {
+	addr, _, err := net.SplitHostPort(remoteAddr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse RemoteAddr: %w", err)
 	}
@@ -288,11 +1073,37 @@ func (g *GeoIP) parseIP(ipStr string) net.IP {
 	return net.ParseIP(ipStr)
 }
 
+// clientFromChain picks the client from a proxy chain such as X-Forwarded-For,
+// listed from the client to the nearest proxy. Entries that are not an IP are
+// nil. With trustedHops set the client is that many entries from the right.
+// Otherwise the chain is walked from the right, skipping trusted proxies, and
+// the first untrusted entry is the client; the leftmost entry is used when
+// every entry is trusted. The entries left of the client are client supplied
+// and never used.
+func (g *GeoIP) clientFromChain(chain []net.IP) net.IP {
+	if len(chain) == 0 {
+		return nil
+	}
+	if g.trustedHops > 0 {
+		if len(chain) < g.trustedHops {
+			return nil
+		}
+		return chain[len(chain)-g.trustedHops]
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i] == nil || !g.isTrustedIP(chain[i]) {
+			return chain[i]
+		}
+	}
+	return chain[0]
+}
+
 // isTrustedProxy checks if the request comes from a trusted proxy
 func (g *GeoIP) isTrustedProxy(remoteAddr string) bool {
 	// If no trusted proxies configured, trust all (backward compatible)
+	// unless strict mode is on
 	if len(g.trustedProxies) == 0 {
-		return true
+		return !g.strictProxies
 	}
 
 	host, _, err := net.SplitHostPort(remoteAddr)
@@ -305,6 +1116,14 @@ func (g *GeoIP) isTrustedProxy(remoteAddr string) bool {
 		return false
 	}
 
+	return g.isTrustedIP(ip)
+}
+
+// isTrustedIP reports whether ip is inside one of the trusted proxy ranges.
+func (g *GeoIP) isTrustedIP(ip net.IP) bool {
+	if len(g.trustedProxies) == 0 {
+		return !g.strictProxies
+	}
 	for _, trustedNet := range g.trustedProxies {
 		if trustedNet.Contains(ip) {
 			return true
@@ -339,7 +1158,17 @@ func (g *GeoIP) addHeaders(req *http.Request, ip net.IP, record IP2Locationrecor
 	if g.region != "" && record.Region != "" {
 		req.Header.Set(g.region, record.Region)
 	}
-	// Note: IP2Location doesn't have region code, so regionCode won't be set
+	if g.regionCode != "" && record.Regioncode != "" {
+		req.Header.Set(g.regionCode, record.Regioncode)
+	}
+
+	// Continent
+	if g.continentCode != "" && record.Continentcode != "" {
+		req.Header.Set(g.continentCode, record.Continentcode)
+	}
+	if g.continentName != "" && record.Continentname != "" {
+		req.Header.Set(g.continentName, record.Continentname)
+	}
 
 	// City
 	if g.city != "" && record.City != "" {
@@ -365,7 +1194,12 @@ func (g *GeoIP) addHeaders(req *http.Request, ip net.IP, record IP2Locationrecor
 	if g.timezone != "" && record.Timezone != "" {
 		req.Header.Set(g.timezone, record.Timezone)
 	}
-	// Note: IP2Location doesn't have accuracy radius
+	if g.accuracyRadius != "" && record.Accuracyradius != 0 {
+		req.Header.Set(g.accuracyRadius, strconv.Itoa(int(record.Accuracyradius)))
+	}
+	if g.addressClass != "" && record.Addressclass != "" {
+		req.Header.Set(g.addressClass, record.Addressclass)
+	}
 
 	// ISP, Domain
 	if g.isp != "" && record.Isp != "" {
@@ -374,7 +1208,72 @@ func (g *GeoIP) addHeaders(req *http.Request, ip net.IP, record IP2Locationrecor
 	if g.domain != "" && record.Domain != "" {
 		req.Header.Set(g.domain, record.Domain)
 	}
-	// Note: IP2Location doesn't have ASN, ConnectionType, UserType
+
+	// ASN
+	if g.asn != "" && record.Asn != "" {
+		req.Header.Set(g.asn, record.Asn)
+	}
+	if g.asnOrganization != "" && record.As != "" {
+		req.Header.Set(g.asnOrganization, record.As)
+	}
+
+	// Connection and user type
+	if g.connectionType != "" && record.Netspeed != "" {
+		req.Header.Set(g.connectionType, connectionTypeOf(record.Netspeed))
+	}
+	if g.userType != "" && record.Usagetype != "" {
+		req.Header.Set(g.userType, userTypeOf(record.Usagetype))
+	}
+
+	// IP2Location specific fields
+	if g.netSpeed != "" && record.Netspeed != "" {
+		req.Header.Set(g.netSpeed, record.Netspeed)
+	}
+	if g.iddCode != "" && record.Iddcode != "" {
+		req.Header.Set(g.iddCode, record.Iddcode)
+	}
+	if g.areaCode != "" && record.Areacode != "" {
+		req.Header.Set(g.areaCode, record.Areacode)
+	}
+	if g.weatherStationCode != "" && record.Weatherstationcode != "" {
+		req.Header.Set(g.weatherStationCode, record.Weatherstationcode)
+	}
+	if g.weatherStationName != "" && record.Weatherstationname != "" {
+		req.Header.Set(g.weatherStationName, record.Weatherstationname)
+	}
+	if g.mcc != "" && record.Mcc != "" {
+		req.Header.Set(g.mcc, record.Mcc)
+	}
+	if g.mnc != "" && record.Mnc != "" {
+		req.Header.Set(g.mnc, record.Mnc)
+	}
+	if g.mobileBrand != "" && record.Mobilebrand != "" {
+		req.Header.Set(g.mobileBrand, record.Mobilebrand)
+	}
+	if g.elevation != "" && record.Elevation != 0 {
+		req.Header.Set(g.elevation, strconv.FormatFloat(float64(record.Elevation), 'f', 2, 32))
+	}
+	if g.usageType != "" && record.Usagetype != "" {
+		req.Header.Set(g.usageType, record.Usagetype)
+	}
+	if g.addressType != "" && record.Addresstype != "" {
+		req.Header.Set(g.addressType, record.Addresstype)
+	}
+	if g.category != "" && record.Category != "" {
+		req.Header.Set(g.category, record.Category)
+	}
+	if g.district != "" && record.District != "" {
+		req.Header.Set(g.district, record.District)
+	}
+
+	// Distance to the configured sites
+	g.addSiteHeaders(req.Header, record)
+	if g.geofences != "" && record.Geofences != "" {
+		req.Header.Set(g.geofences, record.Geofences)
+	}
+
+	// IANA time zone and local time of the client
+	g.addTimezoneHeaders(req.Header, record)
 }
 
 func (g *GeoIP) addResponseHeaders(rw http.ResponseWriter, ip net.IP, record IP2Locationrecord) {
@@ -402,7 +1301,17 @@ func (g *GeoIP) addResponseHeaders(rw http.ResponseWriter, ip net.IP, record IP2
 	if g.region != "" && record.Region != "" {
 		rw.Header().Set(g.region, record.Region)
 	}
-	// Note: IP2Location doesn't have region code
+	if g.regionCode != "" && record.Regioncode != "" {
+		rw.Header().Set(g.regionCode, record.Regioncode)
+	}
+
+	// Continent
+	if g.continentCode != "" && record.Continentcode != "" {
+		rw.Header().Set(g.continentCode, record.Continentcode)
+	}
+	if g.continentName != "" && record.Continentname != "" {
+		rw.Header().Set(g.continentName, record.Continentname)
+	}
 
 	// City
 	if g.city != "" && record.City != "" {
@@ -428,7 +1337,12 @@ func (g *GeoIP) addResponseHeaders(rw http.ResponseWriter, ip net.IP, record IP2
 	if g.timezone != "" && record.Timezone != "" {
 		rw.Header().Set(g.timezone, record.Timezone)
 	}
-	// Note: IP2Location doesn't have accuracy radius
+	if g.accuracyRadius != "" && record.Accuracyradius != 0 {
+		rw.Header().Set(g.accuracyRadius, strconv.Itoa(int(record.Accuracyradius)))
+	}
+	if g.addressClass != "" && record.Addressclass != "" {
+		rw.Header().Set(g.addressClass, record.Addressclass)
+	}
 
 	// ISP, Domain
 	if g.isp != "" && record.Isp != "" {
@@ -437,5 +1351,93 @@ func (g *GeoIP) addResponseHeaders(rw http.ResponseWriter, ip net.IP, record IP2
 	if g.domain != "" && record.Domain != "" {
 		rw.Header().Set(g.domain, record.Domain)
 	}
-	// Note: IP2Location doesn't have ASN, ConnectionType, UserType
+
+	// ASN
+	if g.asn != "" && record.Asn != "" {
+		rw.Header().Set(g.asn, record.Asn)
+	}
+	if g.asnOrganization != "" && record.As != "" {
+		rw.Header().Set(g.asnOrganization, record.As)
+	}
+
+	// Connection and user type
+	if g.connectionType != "" && record.Netspeed != "" {
+		rw.Header().Set(g.connectionType, connectionTypeOf(record.Netspeed))
+	}
+	if g.userType != "" && record.Usagetype != "" {
+		rw.Header().Set(g.userType, userTypeOf(record.Usagetype))
+	}
+
+	// IP2Location specific fields
+	if g.netSpeed != "" && record.Netspeed != "" {
+		rw.Header().Set(g.netSpeed, record.Netspeed)
+	}
+	if g.iddCode != "" && record.Iddcode != "" {
+		rw.Header().Set(g.iddCode, record.Iddcode)
+	}
+	if g.areaCode != "" && record.Areacode != "" {
+		rw.Header().Set(g.areaCode, record.Areacode)
+	}
+	if g.weatherStationCode != "" && record.Weatherstationcode != "" {
+		rw.Header().Set(g.weatherStationCode, record.Weatherstationcode)
+	}
+	if g.weatherStationName != "" && record.Weatherstationname != "" {
+		rw.Header().Set(g.weatherStationName, record.Weatherstationname)
+	}
+	if g.mcc != "" && record.Mcc != "" {
+		rw.Header().Set(g.mcc, record.Mcc)
+	}
+	if g.mnc != "" && record.Mnc != "" {
+		rw.Header().Set(g.mnc, record.Mnc)
+	}
+	if g.mobileBrand != "" && record.Mobilebrand != "" {
+		rw.Header().Set(g.mobileBrand, record.Mobilebrand)
+	}
+	if g.elevation != "" && record.Elevation != 0 {
+		rw.Header().Set(g.elevation, strconv.FormatFloat(float64(record.Elevation), 'f', 2, 32))
+	}
+	if g.usageType != "" && record.Usagetype != "" {
+		rw.Header().Set(g.usageType, record.Usagetype)
+	}
+	if g.addressType != "" && record.Addresstype != "" {
+		rw.Header().Set(g.addressType, record.Addresstype)
+	}
+	if g.category != "" && record.Category != "" {
+		rw.Header().Set(g.category, record.Category)
+	}
+	if g.district != "" && record.District != "" {
+		rw.Header().Set(g.district, record.District)
+	}
+
+	// Distance to the configured sites
+	g.addSiteHeaders(rw.Header(), record)
+	if g.geofences != "" && record.Geofences != "" {
+		rw.Header().Set(g.geofences, record.Geofences)
+	}
+
+	// IANA time zone and local time of the client
+	g.addTimezoneHeaders(rw.Header(), record)
+}
+
+func (g *GeoIP) addProxyHeaders(header http.Header, record IP2Proxyrecord) {
+	// Address not covered by the IP2Proxy database
+	if record.Isproxy < 0 {
+		return
+	}
+
+	if g.isProxy != "" {
+		header.Set(g.isProxy, strconv.Itoa(int(record.Isproxy)))
+	}
+	if g.proxyType != "" && record.Proxytype != "" {
+		header.Set(g.proxyType, record.Proxytype)
+	}
+	if g.proxyProvider != "" && record.Provider != "" {
+		header.Set(g.proxyProvider, record.Provider)
+	}
+	if g.proxyThreat != "" && record.Threat != "" {
+		header.Set(g.proxyThreat, record.Threat)
+	}
+	if g.proxyLastSeen != "" && record.Lastseen != "" {
+		header.Set(g.proxyLastSeen, record.Lastseen)
+	}
 }
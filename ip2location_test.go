@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -62,9 +64,10 @@ func TestGeoIP_ResponseHeaders(t *testing.T) {
 
 	config := &Config{
 		Filename:    dbPath,
-		CountryCode: "X-Test-Country",
-		City:        "X-Test-City",
-		Region:      "X-Test-Region",
+		CountryCode:    "X-Test-Country",
+		City:           "X-Test-City",
+		Region:         "X-Test-Region",
+		ResponseFields: []string{"all"},
 	}
 
 	handler, err := New(context.Background(), &httpHandlerMock{}, config, "test")
@@ -276,3 +279,622 @@ func TestGeoIP_LegacyFields(t *testing.T) {
 		t.Logf("✓ Response header X-GEO-Country: %s", respCountryShort)
 	}
 }
+
+// TestGeoIP_MMDB tests that a MaxMind DB file is detected and used for lookups
+func TestGeoIP_MMDB(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	if err := os.WriteFile(dbPath, buildTestMMDB(t, testMMDBNetworks()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Filename:    dbPath,
+		CountryCode: "X-GEO-Country",
+		City:        "X-GEO-City",
+	}
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/some/path", nil)
+	req.RemoteAddr = "81.2.69.160:34000"
+	rw := httptest.NewRecorder()
+
+	handler.ServeHTTP(rw, req)
+
+	if v := req.Header.Get("X-GEO-Country"); v != "GB" {
+		t.Errorf("X-GEO-Country = %q, want GB", v)
+	}
+	if v := req.Header.Get("X-GEO-City"); v != "London" {
+		t.Errorf("X-GEO-City = %q, want London", v)
+	}
+}
+
+// TestGeoIP_DerivedFields tests the continent, connection type, user type and ASN headers
+func TestGeoIP_DerivedFields(t *testing.T) {
+	dbPath := buildTestBIN(t, 24, []testBINRow{
+		{from: "8.8.8.0", fields: map[string]string{
+			"country_short": "DE",
+			"country_long":  "Germany",
+			"netspeed":      "DSL",
+			"usagetype":     "ISP/MOB",
+		}},
+		{from: "8.8.9.0"},
+	})
+	asnPath := filepath.Join(t.TempDir(), "GeoLite2-ASN.mmdb")
+	asnDB := buildTestMMDB(t, map[string]map[string]interface{}{
+		"8.8.8.0/24": {
+			"autonomous_system_number":       uint32(15169),
+			"autonomous_system_organization": "GOOGLE",
+		},
+	})
+	if err := os.WriteFile(asnPath, asnDB, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Filename:        dbPath,
+		AsnFilename:     asnPath,
+		ContinentCode:   "X-Continent-Code",
+		ContinentName:   "X-Continent-Name",
+		Asn:             "X-ASN",
+		AsnOrganization: "X-ASN-Org",
+		ConnectionType:  "X-Connection-Type",
+		UserType:        "X-User-Type",
+	}
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/some/path", nil)
+	req.RemoteAddr = "8.8.8.8:34000"
+	rw := httptest.NewRecorder()
+
+	handler.ServeHTTP(rw, req)
+
+	expected := map[string]string{
+		"X-Continent-Code":  "EU",
+		"X-Continent-Name":  "Europe",
+		"X-ASN":             "15169",
+		"X-ASN-Org":         "GOOGLE",
+		"X-Connection-Type": "Cable/DSL",
+		"X-User-Type":       "cellular",
+	}
+	for header, want := range expected {
+		if got := req.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// TestGeoIP_MMDBDerivedFields tests region code and accuracy radius from a MaxMind DB file
+func TestGeoIP_MMDBDerivedFields(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	if err := os.WriteFile(dbPath, buildTestMMDB(t, testMMDBNetworks()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Filename:       dbPath,
+		RegionCode:     "X-Region-Code",
+		ContinentName:  "X-Continent-Name",
+		AccuracyRadius: "X-Accuracy-Radius",
+		UserType:       "X-User-Type",
+	}
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/some/path", nil)
+	req.RemoteAddr = "81.2.69.160:34000"
+	rw := httptest.NewRecorder()
+
+	handler.ServeHTTP(rw, req)
+
+	expected := map[string]string{
+		"X-Region-Code":     "ENG",
+		"X-Continent-Name":  "Europe",
+		"X-Accuracy-Radius": "10",
+		"X-User-Type":       "residential",
+	}
+	for header, want := range expected {
+		if got := req.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// TestGeoIP_IP2LocationFields tests the headers for the IP2Location specific fields
+func TestGeoIP_IP2LocationFields(t *testing.T) {
+	dbPath := buildTestBIN(t, 24, []testBINRow{
+		{from: "8.8.8.0", fields: map[string]string{
+			"country_short":      "US",
+			"netspeed":           "T1",
+			"iddcode":            "1",
+			"areacode":           "650",
+			"weatherstationcode": "USCA0746",
+			"weatherstationname": "Mountain View",
+			"mcc":                "310",
+			"mnc":                "410",
+			"mobilebrand":        "AT&T",
+			"elevation":          "32",
+			"usagetype":          "DCH",
+		}},
+		{from: "8.8.9.0"},
+	})
+
+	config := &Config{
+		Filename:           dbPath,
+		NetSpeed:           "X-Net-Speed",
+		IddCode:            "X-IDD-Code",
+		AreaCode:           "X-Area-Code",
+		WeatherStationCode: "X-Weather-Station-Code",
+		WeatherStationName: "X-Weather-Station-Name",
+		Mcc:                "X-MCC",
+		Mnc:                "X-MNC",
+		MobileBrand:        "X-Mobile-Brand",
+		Elevation:          "X-Elevation",
+		UsageType:          "X-Usage-Type",
+		ResponseFields:     []string{"all"},
+	}
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/some/path", nil)
+	req.RemoteAddr = "8.8.8.8:34000"
+	rw := httptest.NewRecorder()
+
+	handler.ServeHTTP(rw, req)
+
+	expected := map[string]string{
+		"X-Net-Speed":            "T1",
+		"X-IDD-Code":             "1",
+		"X-Area-Code":            "650",
+		"X-Weather-Station-Code": "USCA0746",
+		"X-Weather-Station-Name": "Mountain View",
+		"X-MCC":                  "310",
+		"X-MNC":                  "410",
+		"X-Mobile-Brand":         "AT&T",
+		"X-Elevation":            "32.00",
+		"X-Usage-Type":           "DCH",
+	}
+	for header, want := range expected {
+		if got := req.Header.Get(header); got != want {
+			t.Errorf("request %s = %q, want %q", header, got, want)
+		}
+		if got := rw.Header().Get(header); got != want {
+			t.Errorf("response %s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// TestGeoIP_StrictFields tests that mapping a field missing from the BIN type fails with strict_fields
+func TestGeoIP_StrictFields(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "8.8.8.0", fields: map[string]string{"country_short": "US"}},
+	})
+
+	config := &Config{
+		Filename:    dbPath,
+		CountryCode: "X-Country-Code",
+		City:        "X-City",
+		Mcc:         "X-MCC",
+	}
+
+	if _, err := New(context.Background(), &httpHandlerMock{}, config, "test"); err != nil {
+		t.Fatalf("Expected only a warning without strict_fields, got: %v", err)
+	}
+
+	config.StrictFields = true
+	_, err := New(context.Background(), &httpHandlerMock{}, config, "test")
+	if err == nil {
+		t.Fatal("Expected error for fields missing from database type 1")
+	}
+	if !strings.Contains(err.Error(), "city") || !strings.Contains(err.Error(), "mcc") || strings.Contains(err.Error(), "country_code") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestGeoIP_DB26Fields tests the ASN, category and district headers from a DB26 BIN file
+func TestGeoIP_DB26Fields(t *testing.T) {
+	dbPath := buildTestBIN(t, 26, []testBINRow{
+		{from: "8.8.8.0", fields: map[string]string{
+			"country_short": "US",
+			"category":      "IAB19-11",
+			"district":      "Santa Clara County",
+			"asn":           "15169",
+			"as":            "Google LLC",
+		}},
+		{from: "8.8.9.0"},
+	})
+
+	config := &Config{
+		Filename:        dbPath,
+		Asn:             "X-ASN",
+		AsnOrganization: "X-ASN-Org",
+		Category:        "X-Category",
+		District:        "X-District",
+		StrictFields:    true,
+	}
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/some/path", nil)
+	req.RemoteAddr = "8.8.8.8:34000"
+	rw := httptest.NewRecorder()
+
+	handler.ServeHTTP(rw, req)
+
+	expected := map[string]string{
+		"X-ASN":      "15169",
+		"X-ASN-Org":  "Google LLC",
+		"X-Category": "IAB19-11",
+		"X-District": "Santa Clara County",
+	}
+	for header, want := range expected {
+		if got := req.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// TestGeoIP_Proxy tests the IP2Proxy headers alongside the geolocation headers
+func TestGeoIP_Proxy(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "1.2.3.0", fields: map[string]string{"country_short": "NL"}},
+		{from: "1.2.4.0"},
+	})
+	proxyPath := buildTestPX(t, 11, []testBINRow{
+		{from: "1.2.3.0", fields: map[string]string{
+			"country_short": "NL",
+			"proxytype":     "VPN",
+			"lastseen":      "3",
+			"threat":        "SPAM",
+			"provider":      "ExampleVPN",
+		}},
+		{from: "1.2.4.0", fields: map[string]string{"country_short": "-", "proxytype": "-"}},
+	})
+
+	config := &Config{
+		Filename:      dbPath,
+		ProxyFilename: proxyPath,
+		CountryCode:   "X-Country-Code",
+		IsProxy:       "X-Is-Proxy",
+		ProxyType:     "X-Proxy-Type",
+		ProxyProvider: "X-Proxy-Provider",
+		ProxyThreat:   "X-Proxy-Threat",
+		ProxyLastSeen: "X-Proxy-Last-Seen",
+	}
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/some/path", nil)
+	req.RemoteAddr = "1.2.3.4:34000"
+	rw := httptest.NewRecorder()
+
+	handler.ServeHTTP(rw, req)
+
+	expected := map[string]string{
+		"X-Country-Code":    "NL",
+		"X-Is-Proxy":        "1",
+		"X-Proxy-Type":      "VPN",
+		"X-Proxy-Provider":  "ExampleVPN",
+		"X-Proxy-Threat":    "SPAM",
+		"X-Proxy-Last-Seen": "3",
+	}
+	for header, want := range expected {
+		if got := req.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/some/path", nil)
+	req.RemoteAddr = "1.2.4.4:34000"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := req.Header.Get("X-Is-Proxy"); got != "0" {
+		t.Errorf("X-Is-Proxy = %q, want 0", got)
+	}
+}
+
+func TestGeoIP_StripsClientHeaders(t *testing.T) {
+	dbPath := buildTestBIN(t, 3, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB", "region": "England"}},
+		{from: "81.2.70.0"},
+	})
+
+	config := &Config{
+		Filename:          dbPath,
+		CountryCode:       "X-GEO-Country-Code",
+		City:              "X-GEO-City",
+		Region:            "X-Region",
+		StripHeaderPrefix: []string{"x-geo-*"},
+	}
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/some/path", nil)
+	req.RemoteAddr = "81.2.69.160:34000"
+	req.Header.Set("X-GEO-Country-Code", "US")
+	req.Header.Set("X-GEO-City", "New York")
+	req.Header.Set("X-GEO-Is-Admin", "true")
+	req.Header.Set("X-Region", "Texas")
+	req.Header.Set("X-GEOIP-ERROR", "forged")
+	req.Header.Set("X-Other", "kept")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	expected := map[string]string{
+		"X-GEO-Country-Code": "GB",
+		"X-Region":           "England",
+		"X-GEO-City":         "",
+		"X-GEO-Is-Admin":     "",
+		"X-GEOIP-ERROR":      "",
+		"X-Other":            "kept",
+	}
+	for header, want := range expected {
+		if got := req.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestGeoIP_XForwardedForChain(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.70.0"},
+	})
+
+	// hop counts are tested with the shipped defaults, strict mode included
+	hops := func(n int) *Config {
+		config := CreateConfig()
+		config.TrustedHops = n
+		return config
+	}
+
+	tests := []struct {
+		name   string
+		config *Config
+		xff    []string
+		want   string
+	}{
+		{
+			name:   "spoofed entry left of the client is ignored",
+			config: &Config{TrustedProxies: []string{"10.0.0.0/8"}},
+			xff:    []string{"1.1.1.1, 81.2.69.160, 10.0.0.7"},
+			want:   "81.2.69.160",
+		},
+		{
+			name:   "multiple header lines",
+			config: &Config{TrustedProxies: []string{"10.0.0.0/8"}},
+			xff:    []string{"1.1.1.1", "81.2.69.160", "10.0.0.7"},
+			want:   "81.2.69.160",
+		},
+		{
+			name:   "invalid entry stops the walk",
+			config: &Config{TrustedProxies: []string{"10.0.0.0/8"}},
+			xff:    []string{"81.2.69.160, garbage, 10.0.0.7"},
+			want:   "10.0.0.1",
+		},
+		{
+			name:   "all trusted uses leftmost",
+			config: &Config{TrustedProxies: []string{"10.0.0.0/8"}},
+			xff:    []string{"10.1.1.1, 10.0.0.7"},
+			want:   "10.1.1.1",
+		},
+		{
+			name:   "hop count",
+			config: hops(2),
+			xff:    []string{"1.1.1.1, 81.2.69.160, 172.16.0.1"},
+			want:   "81.2.69.160",
+		},
+		{
+			name:   "hop count longer than chain",
+			config: hops(3),
+			xff:    []string{"81.2.69.160, 172.16.0.1"},
+			want:   "10.0.0.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := *tt.config
+			config.Filename = dbPath
+			config.ClientIp = "X-Client-Addr"
+			config.UseXForwardedFor = true
+
+			handler, err := New(context.Background(), &httpHandlerMock{}, &config, "test")
+			if err != nil {
+				t.Fatalf("Failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			for _, xff := range tt.xff {
+				req.Header.Add("X-Forwarded-For", xff)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got := req.Header.Get("X-Client-Addr"); got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeoIP_TrustedHopsStrictDefault(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.70.0"},
+	})
+
+	config := CreateConfig()
+	config.Filename = dbPath
+	config.ClientIp = "X-Client-Addr"
+	config.UseForwarded = true
+	config.TrustedHops = 1
+	handler, err := New(context.Background(), &httpHandlerMock{}, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		header string
+		value  string
+		want   string
+	}{
+		{"X-Forwarded-For", "81.2.69.160", "81.2.69.160"},
+		{"Forwarded", "for=81.2.69.161", "81.2.69.161"},
+		// single IP headers still need a trusted peer
+		{"X-Real-IP", "81.2.69.162", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(tt.header, tt.value)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got := req.Header.Get("X-Client-Addr"); got != tt.want {
+			t.Errorf("%s: client IP = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGeoIP_RequestResponseFields(t *testing.T) {
+	dbPath := buildTestBIN(t, 3, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB", "city": "London"}},
+		{from: "81.2.70.0"},
+	})
+
+	tests := []struct {
+		name     string
+		request  []string
+		response []string
+		wantReq  map[string]string
+		wantResp map[string]string
+	}{
+		{
+			name:     "defaults",
+			wantReq:  map[string]string{"X-Country-Code": "GB", "X-City": "London"},
+			wantResp: map[string]string{"X-Country-Code": "", "X-City": ""},
+		},
+		{
+			name:     "subset to the response",
+			response: []string{"country_code"},
+			wantReq:  map[string]string{"X-Country-Code": "GB", "X-City": "London"},
+			wantResp: map[string]string{"X-Country-Code": "GB", "X-City": ""},
+		},
+		{
+			name:     "subset to the request",
+			request:  []string{"city"},
+			response: []string{"all"},
+			wantReq:  map[string]string{"X-Country-Code": "", "X-City": "London"},
+			wantResp: map[string]string{"X-Country-Code": "GB", "X-City": "London"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+				Filename:       dbPath,
+				CountryCode:    "X-Country-Code",
+				City:           "X-City",
+				RequestFields:  tt.request,
+				ResponseFields: tt.response,
+			}, "test")
+			if err != nil {
+				t.Fatalf("Failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+			req.RemoteAddr = "81.2.69.160:1234"
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			for header, want := range tt.wantReq {
+				if got := req.Header.Get(header); got != want {
+					t.Errorf("request %s = %q, want %q", header, got, want)
+				}
+			}
+			for header, want := range tt.wantResp {
+				if got := rw.Header().Get(header); got != want {
+					t.Errorf("response %s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+
+	_, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:       dbPath,
+		ResponseFields: []string{"country"},
+	}, "test")
+	if err == nil {
+		t.Error("Expected error for unknown response_fields entry")
+	}
+}
+
+func TestGeoIP_ErrorTargets(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.70.0"},
+	})
+
+	tests := []struct {
+		targets      []string
+		disable      bool
+		wantUpstream bool
+		wantClient   bool
+	}{
+		{nil, false, true, false},
+		{[]string{"client", "upstream"}, false, true, true},
+		{[]string{"log"}, false, false, false},
+		{[]string{"client"}, true, false, false},
+	}
+	for _, tt := range tests {
+		handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+			Filename:           dbPath,
+			FromHeader:         "X-Custom-IP",
+			ErrorTargets:       tt.targets,
+			DisableErrorHeader: tt.disable,
+		}, "test")
+		if err != nil {
+			t.Fatalf("Failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.RemoteAddr = "bogus"
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		if got := req.Header.Get("X-GEOIP-ERROR") != ""; got != tt.wantUpstream {
+			t.Errorf("%v: upstream error header set = %v, want %v", tt.targets, got, tt.wantUpstream)
+		}
+		if got := rw.Header().Get("X-GEOIP-ERROR") != ""; got != tt.wantClient {
+			t.Errorf("%v: client error header set = %v, want %v", tt.targets, got, tt.wantClient)
+		}
+	}
+
+	_, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:     dbPath,
+		ErrorTargets: []string{"syslog"},
+	}, "test")
+	if err == nil {
+		t.Error("Expected error for invalid error_targets entry")
+	}
+}
@@ -3,15 +3,15 @@
 
 // This ip2location package provides a fast lookup of country, region, city, latitude, longitude, ZIP code, time zone,
 // ISP, domain name, connection type, IDD code, area code, weather station code, station name, MCC, MNC,
-// mobile brand, elevation, and usage type from IP address by using IP2Location database.
+// mobile brand, elevation, usage type, address type, IAB category, district, autonomous system number (ASN)
+// and autonomous system (AS) from IP address by using IP2Location database.
 package traefik_plugin_ip2location
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
-	"math/big"
 	"net"
 	"os"
 	"strconv"
@@ -31,6 +31,7 @@ type ip2locationmeta struct {
 	ipv6indexbaseaddr uint32
 	ipv4columnsize    uint32
 	ipv6columnsize    uint32
+	productcode       uint8
 }
 
 // The IP2Locationrecord struct stores all of the available
@@ -56,10 +57,25 @@ type IP2Locationrecord struct {
 	Mobilebrand        string
 	Elevation          float32
 	Usagetype          string
+	Addresstype        string
+	Category           string
+	District           string
+	Asn                string
+	As                 string
+	// The fields below are not stored in IP2Location BIN files. They are
+	// filled by the MMDB reader, or derived by the plugin after the lookup.
+	Regioncode     string
+	Continentcode  string
+	Continentname  string
+	Accuracyradius uint16
+	Addressclass   string
+	Geofences      string // comma separated
+	Timezonename   string // IANA name, e.g. Europe/Berlin
 }
 
 type DB struct {
 	f    *os.File
+	buf  []byte // whole file, set instead of f when opened in memory
 	meta ip2locationmeta
 
 	country_position_offset            uint32
@@ -81,6 +97,11 @@ type DB struct {
 	mobilebrand_position_offset        uint32
 	elevation_position_offset          uint32
 	usagetype_position_offset          uint32
+	addresstype_position_offset        uint32
+	category_position_offset           uint32
+	district_position_offset           uint32
+	asn_position_offset                uint32
+	as_position_offset                 uint32
 
 	country_enabled            bool
 	region_enabled             bool
@@ -88,8 +109,8 @@ type DB struct {
 	isp_enabled                bool
 	domain_enabled             bool
 	zipcode_enabled            bool
-	latitude_enabled          bool
-	longitude_enabled         bool
+	latitude_enabled           bool
+	longitude_enabled          bool
 	timezone_enabled           bool
 	netspeed_enabled           bool
 	iddcode_enabled            bool
@@ -101,29 +122,39 @@ type DB struct {
 	mobilebrand_enabled        bool
 	elevation_enabled          bool
 	usagetype_enabled          bool
+	addresstype_enabled        bool
+	category_enabled           bool
+	district_enabled           bool
+	asn_enabled                bool
+	as_enabled                 bool
 
 	metaok bool
 }
 
-var country_position = [25]uint8{0, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2}
-var region_position = [25]uint8{0, 0, 0, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3}
-var city_position = [25]uint8{0, 0, 0, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4}
-var isp_position = [25]uint8{0, 0, 3, 0, 5, 0, 7, 5, 7, 0, 8, 0, 9, 0, 9, 0, 9, 0, 9, 7, 9, 0, 9, 7, 9}
-var latitude_position = [25]uint8{0, 0, 0, 0, 0, 5, 5, 0, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5}
-var longitude_position = [25]uint8{0, 0, 0, 0, 0, 6, 6, 0, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6}
-var domain_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 6, 8, 0, 9, 0, 10, 0, 10, 0, 10, 0, 10, 8, 10, 0, 10, 8, 10}
-var zipcode_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 7, 7, 7, 7, 0, 7, 7, 7, 0, 7, 0, 7, 7, 7, 0, 7}
-var timezone_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 8, 8, 7, 8, 8, 8, 7, 8, 0, 8, 8, 8, 0, 8}
-var netspeed_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 8, 11, 0, 11, 8, 11, 0, 11, 0, 11, 0, 11}
-var iddcode_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 9, 12, 0, 12, 0, 12, 9, 12, 0, 12}
-var areacode_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 13, 0, 13, 0, 13, 10, 13, 0, 13}
-var weatherstationcode_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 9, 14, 0, 14, 0, 14, 0, 14}
-var weatherstationname_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 15, 0, 15, 0, 15, 0, 15}
-var mcc_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 9, 16, 0, 16, 9, 16}
-var mnc_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 17, 0, 17, 10, 17}
-var mobilebrand_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 11, 18, 0, 18, 11, 18}
-var elevation_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 11, 19, 0, 19}
-var usagetype_position = [25]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 12, 20}
+var country_position = [27]uint8{0, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2}
+var region_position = [27]uint8{0, 0, 0, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3}
+var city_position = [27]uint8{0, 0, 0, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4}
+var isp_position = [27]uint8{0, 0, 3, 0, 5, 0, 7, 5, 7, 0, 8, 0, 9, 0, 9, 0, 9, 0, 9, 7, 9, 0, 9, 7, 9, 9, 9}
+var latitude_position = [27]uint8{0, 0, 0, 0, 0, 5, 5, 0, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5}
+var longitude_position = [27]uint8{0, 0, 0, 0, 0, 6, 6, 0, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6}
+var domain_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 6, 8, 0, 9, 0, 10, 0, 10, 0, 10, 0, 10, 8, 10, 0, 10, 8, 10, 10, 10}
+var zipcode_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 7, 7, 7, 7, 0, 7, 7, 7, 0, 7, 0, 7, 7, 7, 0, 7, 7, 7}
+var timezone_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 8, 8, 7, 8, 8, 8, 7, 8, 0, 8, 8, 8, 0, 8, 8, 8}
+var netspeed_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 8, 11, 0, 11, 8, 11, 0, 11, 0, 11, 0, 11, 11, 11}
+var iddcode_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 9, 12, 0, 12, 0, 12, 9, 12, 0, 12, 12, 12}
+var areacode_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 13, 0, 13, 0, 13, 10, 13, 0, 13, 13, 13}
+var weatherstationcode_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 9, 14, 0, 14, 0, 14, 0, 14, 14, 14}
+var weatherstationname_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 15, 0, 15, 0, 15, 0, 15, 15, 15}
+var mcc_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 9, 16, 0, 16, 9, 16, 16, 16}
+var mnc_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 17, 0, 17, 10, 17, 17, 17}
+var mobilebrand_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 11, 18, 0, 18, 11, 18, 18, 18}
+var elevation_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 11, 19, 0, 19, 19, 19}
+var usagetype_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 12, 20, 20, 20}
+var addresstype_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 21, 21}
+var category_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 22, 22}
+var district_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 23}
+var asn_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 24}
+var as_position = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 25}
 
 const countryshort uint32 = 0x00001
 const countrylong uint32 = 0x00002
@@ -145,88 +176,142 @@ const mnc uint32 = 0x10000
 const mobilebrand uint32 = 0x20000
 const elevation uint32 = 0x40000
 const usagetype uint32 = 0x80000
+const addresstype uint32 = 0x100000
+const category uint32 = 0x200000
+const district uint32 = 0x400000
+const asn uint32 = 0x800000
+const as uint32 = 0x1000000
 
-const all uint32 = countryshort | countrylong | region | city | isp | latitude | longitude | domain | zipcode | timezone | netspeed | iddcode | areacode | weatherstationcode | weatherstationname | mcc | mnc | mobilebrand | elevation | usagetype
+const all uint32 = countryshort | countrylong | region | city | isp | latitude | longitude | domain | zipcode | timezone | netspeed | iddcode | areacode | weatherstationcode | weatherstationname | mcc | mnc | mobilebrand | elevation | usagetype | addresstype | category | district | asn | as
+
+const ip2location_productcode uint8 = 1
+const ip2proxy_productcode uint8 = 2
 
 const invalid_address string = "Invalid IP address."
 const missing_file string = "Invalid database file."
 const not_supported string = "This parameter is unavailable for selected data file. Please upgrade the data file."
 
-var max_ipv4_range = big.NewInt(4294967295)
-var max_ipv6_range = big.NewInt(0)
-var from_v4mapped = big.NewInt(281470681743360)
-var to_v4mapped = big.NewInt(281474976710655)
-var from_6to4 = big.NewInt(0)
-var to_6to4 = big.NewInt(0)
-var from_teredo = big.NewInt(0)
-var to_teredo = big.NewInt(0)
-var last_32bits = big.NewInt(4294967295)
+// uint128 is an IP number split into its high and low 64 bits, so that the
+// binary search compares fixed-width integers instead of allocating big.Ints.
+type uint128 struct {
+	hi, lo uint64
+}
 
-// get IP type and calculate IP number; calculates index too if exists
-func (d *DB) checkip(ip string) (iptype uint32, ipnum *big.Int, ipindex uint32) {
-	iptype = 0
-	ipnum = big.NewInt(0)
-	ipnumtmp := big.NewInt(0)
-	ipindex = 0
-	ipaddress := net.ParseIP(ip)
+func (a uint128) cmp(b uint128) int {
+	switch {
+	case a.hi < b.hi || (a.hi == b.hi && a.lo < b.lo):
+		return -1
+	case a == b:
+		return 0
+	}
+	return 1
+}
+
+// dec returns a - 1.
+func (a uint128) dec() uint128 {
+	if a.lo == 0 {
+		a.hi--
+	}
+	a.lo--
+	return a
+}
 
-	if ipaddress != nil {
-		v4 := ipaddress.To4()
+var max_ipv4_range = uint128{lo: math.MaxUint32}
+var max_ipv6_range = uint128{hi: math.MaxUint64, lo: math.MaxUint64}
 
-		if v4 != nil {
-			iptype = 4
-			ipnum.SetBytes(v4)
-		} else {
-			v6 := ipaddress.To16()
-
-			if v6 != nil {
-				iptype = 6
-				ipnum.SetBytes(v6)
-
-				if ipnum.Cmp(from_v4mapped) >= 0 && ipnum.Cmp(to_v4mapped) <= 0 {
-					// ipv4-mapped ipv6 should treat as ipv4 and read ipv4 data section
-					iptype = 4
-					ipnum.Sub(ipnum, from_v4mapped)
-				} else if ipnum.Cmp(from_6to4) >= 0 && ipnum.Cmp(to_6to4) <= 0 {
-					// 6to4 so need to remap to ipv4
-					iptype = 4
-					ipnum.Rsh(ipnum, 80)
-					ipnum.And(ipnum, last_32bits)
-				} else if ipnum.Cmp(from_teredo) >= 0 && ipnum.Cmp(to_teredo) <= 0 {
-					// Teredo so need to remap to ipv4
-					iptype = 4
-					ipnum.Not(ipnum)
-					ipnum.And(ipnum, last_32bits)
-				}
-			}
-		}
+// ipRange is the [from, to) span of IP numbers that a BIN row applies to.
+// iptype is 0 when the span is unknown.
+type ipRange struct {
+	iptype   uint32
+	from, to uint128
+}
+
+func (r ipRange) contains(iptype uint32, ipnum uint128) bool {
+	return r.iptype != 0 && r.iptype == iptype && ipnum.cmp(r.from) >= 0 && ipnum.cmp(r.to) < 0
+}
+
+// intersect returns the span covered by both r and o, or an unknown span.
+func (r ipRange) intersect(o ipRange) ipRange {
+	if r.iptype == 0 || r.iptype != o.iptype {
+		return ipRange{}
+	}
+	if o.from.cmp(r.from) > 0 {
+		r.from = o.from
 	}
+	if o.to.cmp(r.to) < 0 {
+		r.to = o.to
+	}
+	if r.from.cmp(r.to) >= 0 {
+		return ipRange{}
+	}
+	return r
+}
+
+// get IP type and calculate IP number; calculates index too if exists
+func (d *DB) checkip(ip string) (iptype uint32, ipnum uint128, ipindex uint32) {
+	ipaddress := net.ParseIP(ip)
+	if ipaddress == nil {
+		return
+	}
+
+	iptype, ipnum = ipnumber(ipaddress)
 	if iptype == 4 {
 		if d.meta.ipv4indexbaseaddr > 0 {
-			ipnumtmp.Rsh(ipnum, 16)
-			ipnumtmp.Lsh(ipnumtmp, 3)
-			ipindex = uint32(ipnumtmp.Add(ipnumtmp, big.NewInt(int64(d.meta.ipv4indexbaseaddr))).Uint64())
+			ipindex = uint32(ipnum.lo>>16)<<3 + d.meta.ipv4indexbaseaddr
 		}
-	} else if iptype == 6 {
-		if d.meta.ipv6indexbaseaddr > 0 {
-			ipnumtmp.Rsh(ipnum, 112)
-			ipnumtmp.Lsh(ipnumtmp, 3)
-			ipindex = uint32(ipnumtmp.Add(ipnumtmp, big.NewInt(int64(d.meta.ipv6indexbaseaddr))).Uint64())
+	} else if d.meta.ipv6indexbaseaddr > 0 {
+		ipindex = uint32(ipnum.hi>>48)<<3 + d.meta.ipv6indexbaseaddr
+	}
+	return
+}
+
+// ipnumber returns the IP type and number used to search the BIN data sections.
+func ipnumber(ipaddress net.IP) (iptype uint32, ipnum uint128) {
+	// ipv4-mapped ipv6 is returned as ipv4 by To4 and reads the ipv4 data section
+	if v4 := ipaddress.To4(); v4 != nil {
+		iptype = 4
+		ipnum.lo = uint64(binary.BigEndian.Uint32(v4))
+	} else {
+		iptype = 6
+		ipnum.hi = binary.BigEndian.Uint64(ipaddress[:8])
+		ipnum.lo = binary.BigEndian.Uint64(ipaddress[8:])
+
+		if ipnum.hi>>48 == 0x2002 {
+			// 6to4 so need to remap to ipv4
+			iptype = 4
+			ipnum = uint128{lo: (ipnum.hi >> 16) & math.MaxUint32}
+		} else if ipnum.hi>>32 == 0x20010000 {
+			// Teredo so need to remap to ipv4
+			iptype = 4
+			ipnum = uint128{lo: ^ipnum.lo & math.MaxUint32}
 		}
 	}
 	return
 }
 
+// readat returns n bytes at the 0-based offset pos. Databases opened in memory
+// return a slice of the loaded file, without a copy or a syscall.
+func (d *DB) readat(pos int64, n int) ([]byte, error) {
+	if d.buf != nil {
+		if pos < 0 || pos+int64(n) > int64(len(d.buf)) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return d.buf[pos : pos+int64(n)], nil
+	}
+	data := make([]byte, n)
+	if _, err := d.f.ReadAt(data, pos); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
 // read byte
 func (d *DB) readuint8(pos int64) (uint8, error) {
-	var retval uint8
-	data := make([]byte, 1)
-	_, err := d.f.ReadAt(data, pos-1)
+	data, err := d.readat(pos-1, 1)
 	if err != nil {
 		return 0, err
 	}
-	retval = data[0]
-	return retval, nil
+	return data[0], nil
 }
 
 // read unsigned 32-bit integer from slices
@@ -239,56 +324,33 @@ func (d *DB) readuint32_row(row []byte, pos uint32) uint32 {
 
 // read unsigned 32-bit integer
 func (d *DB) readuint32(pos uint32) (uint32, error) {
-	pos2 := int64(pos)
-	var retval uint32
-	data := make([]byte, 4)
-	_, err := d.f.ReadAt(data, pos2-1)
+	data, err := d.readat(int64(pos)-1, 4)
 	if err != nil {
 		return 0, err
 	}
-	buf := bytes.NewReader(data)
-	err = binary.Read(buf, binary.LittleEndian, &retval)
-	if err != nil {
-		fmt.Printf("binary read failed: %v", err)
-	}
-	return retval, nil
+	return binary.LittleEndian.Uint32(data), nil
 }
 
 // read unsigned 128-bit integer
-func (d *DB) readuint128(pos uint32) (*big.Int, error) {
-	pos2 := int64(pos)
-	retval := big.NewInt(0)
-	data := make([]byte, 16)
-	_, err := d.f.ReadAt(data, pos2-1)
+func (d *DB) readuint128(pos uint32) (uint128, error) {
+	data, err := d.readat(int64(pos)-1, 16)
 	if err != nil {
-		return nil, err
+		return uint128{}, err
 	}
-
-	// little endian to big endian
-	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
-		data[i], data[j] = data[j], data[i]
-	}
-	retval.SetBytes(data)
-	return retval, nil
+	return uint128{hi: binary.LittleEndian.Uint64(data[8:]), lo: binary.LittleEndian.Uint64(data[:8])}, nil
 }
 
 // read string
 func (d *DB) readstr(pos uint32) (string, error) {
-	pos2 := int64(pos)
-	var retval string
-	lenbyte := make([]byte, 1)
-	_, err := d.f.ReadAt(lenbyte, pos2)
+	lenbyte, err := d.readat(int64(pos), 1)
 	if err != nil {
 		return "", err
 	}
-	strlen := lenbyte[0]
-	data := make([]byte, strlen)
-	_, err = d.f.ReadAt(data, pos2+1)
+	data, err := d.readat(int64(pos)+1, int(lenbyte[0]))
 	if err != nil {
 		return "", err
 	}
-	retval = string(data[:int(strlen)])
-	return retval, nil
+	return string(data), nil
 }
 
 // read float from slices
@@ -302,91 +364,121 @@ func (d *DB) readfloat_row(row []byte, pos uint32) float32 {
 
 // read float
 func (d *DB) readfloat(pos uint32) (float32, error) {
-	pos2 := int64(pos)
-	var retval float32
-	data := make([]byte, 4)
-	_, err := d.f.ReadAt(data, pos2-1)
+	data, err := d.readat(int64(pos)-1, 4)
 	if err != nil {
 		return 0, err
 	}
-	buf := bytes.NewReader(data)
-	err = binary.Read(buf, binary.LittleEndian, &retval)
-	if err != nil {
-		fmt.Printf("binary read failed: %v", err)
-	}
-	return retval, nil
-}
-
-func fatal(db *DB, err error) (*DB, error) {
-	_ = db.f.Close()
-	return nil, err
+	return math.Float32frombits(binary.LittleEndian.Uint32(data)), nil
 }
 
-// OpenDB takes the path to the IP2Location BIN database file. It will read all the metadata required to
-// be able to extract the embedded geolocation data, and return the underlining DB object.
-func OpenDB(dbpath string) (*DB, error) {
-	var db = &DB{}
-
-	max_ipv6_range.SetString("340282366920938463463374607431768211455", 10)
-	from_6to4.SetString("42545680458834377588178886921629466624", 10)
-	to_6to4.SetString("42550872755692912415807417417958686719", 10)
-	from_teredo.SetString("42540488161975842760550356425300246528", 10)
-	to_teredo.SetString("42540488241204005274814694018844196863", 10)
-
+// readmeta reads the BIN header, which is shared by IP2Location and IP2Proxy files.
+func (d *DB) readmeta() error {
 	var err error
-	db.f, err = os.Open(dbpath)
+
+	d.meta.databasetype, err = d.readuint8(1)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	db.meta.databasetype, err = db.readuint8(1)
+	d.meta.databasecolumn, err = d.readuint8(2)
 	if err != nil {
-		return fatal(db, err)
+		return err
 	}
-	db.meta.databasecolumn, err = db.readuint8(2)
+	d.meta.databaseyear, err = d.readuint8(3)
 	if err != nil {
-		return fatal(db, err)
+		return err
 	}
-	db.meta.databaseyear, err = db.readuint8(3)
+	d.meta.databasemonth, err = d.readuint8(4)
 	if err != nil {
-		return fatal(db, err)
+		return err
 	}
-	db.meta.databasemonth, err = db.readuint8(4)
+	d.meta.databaseday, err = d.readuint8(5)
 	if err != nil {
-		return fatal(db, err)
+		return err
 	}
-	db.meta.databaseday, err = db.readuint8(5)
+	d.meta.ipv4databasecount, err = d.readuint32(6)
 	if err != nil {
-		return fatal(db, err)
+		return err
 	}
-	db.meta.ipv4databasecount, err = db.readuint32(6)
+	d.meta.ipv4databaseaddr, err = d.readuint32(10)
 	if err != nil {
-		return fatal(db, err)
+		return err
 	}
-	db.meta.ipv4databaseaddr, err = db.readuint32(10)
+	d.meta.ipv6databasecount, err = d.readuint32(14)
 	if err != nil {
-		return fatal(db, err)
+		return err
 	}
-	db.meta.ipv6databasecount, err = db.readuint32(14)
+	d.meta.ipv6databaseaddr, err = d.readuint32(18)
 	if err != nil {
-		return fatal(db, err)
+		return err
 	}
-	db.meta.ipv6databaseaddr, err = db.readuint32(18)
+	d.meta.ipv4indexbaseaddr, err = d.readuint32(22)
 	if err != nil {
-		return fatal(db, err)
+		return err
 	}
-	db.meta.ipv4indexbaseaddr, err = db.readuint32(22)
+	d.meta.ipv6indexbaseaddr, err = d.readuint32(26)
 	if err != nil {
-		return fatal(db, err)
+		return err
 	}
-	db.meta.ipv6indexbaseaddr, err = db.readuint32(26)
+	d.meta.productcode, err = d.readuint8(30)
 	if err != nil {
+		return err
+	}
+	d.meta.ipv4columnsize = uint32(d.meta.databasecolumn << 2)              // 4 bytes each column
+	d.meta.ipv6columnsize = uint32(16 + ((d.meta.databasecolumn - 1) << 2)) // 4 bytes each column, except IPFrom column which is 16 bytes
+
+	return nil
+}
+
+func fatal(db *DB, err error) (*DB, error) {
+	db.Close()
+	return nil, err
+}
+
+// open opens the BIN file and reads its header. In memory mode the whole file
+// is read once and no file handle is kept.
+func (d *DB) open(dbpath string, inMemory bool) error {
+	if inMemory {
+		buf, err := os.ReadFile(dbpath)
+		if err != nil {
+			return err
+		}
+		d.buf = buf
+	} else {
+		f, err := os.Open(dbpath)
+		if err != nil {
+			return err
+		}
+		d.f = f
+	}
+	return d.readmeta()
+}
+
+// OpenDB takes the path to the IP2Location BIN database file. It will read all the metadata required to
+// be able to extract the embedded geolocation data, and return the underlining DB object.
+func OpenDB(dbpath string) (*DB, error) {
+	return openDB(dbpath, false)
+}
+
+// OpenDBInMemory is like OpenDB but loads the whole BIN file into memory, so lookups
+// do not allocate or make syscalls for file reads. Yaegi cannot mmap, hence the copy.
+func OpenDBInMemory(dbpath string) (*DB, error) {
+	return openDB(dbpath, true)
+}
+
+func openDB(dbpath string, inMemory bool) (*DB, error) {
+	var db = &DB{}
+
+	if err := db.open(dbpath, inMemory); err != nil {
 		return fatal(db, err)
 	}
-	db.meta.ipv4columnsize = uint32(db.meta.databasecolumn << 2)              // 4 bytes each column
-	db.meta.ipv6columnsize = uint32(16 + ((db.meta.databasecolumn - 1) << 2)) // 4 bytes each column, except IPFrom column which is 16 bytes
+	if db.meta.productcode == ip2proxy_productcode {
+		return fatal(db, fmt.Errorf("this is an IP2Proxy BIN file, use OpenProxyDB instead"))
+	}
 
 	dbt := db.meta.databasetype
+	if int(dbt) >= len(country_position) {
+		return fatal(db, fmt.Errorf("unsupported IP2Location database type %d", dbt))
+	}
 
 	if country_position[dbt] != 0 {
 		db.country_position_offset = uint32(country_position[dbt]-2) << 2
@@ -464,6 +556,26 @@ func OpenDB(dbpath string) (*DB, error) {
 		db.usagetype_position_offset = uint32(usagetype_position[dbt]-2) << 2
 		db.usagetype_enabled = true
 	}
+	if addresstype_position[dbt] != 0 {
+		db.addresstype_position_offset = uint32(addresstype_position[dbt]-2) << 2
+		db.addresstype_enabled = true
+	}
+	if category_position[dbt] != 0 {
+		db.category_position_offset = uint32(category_position[dbt]-2) << 2
+		db.category_enabled = true
+	}
+	if district_position[dbt] != 0 {
+		db.district_position_offset = uint32(district_position[dbt]-2) << 2
+		db.district_enabled = true
+	}
+	if asn_position[dbt] != 0 {
+		db.asn_position_offset = uint32(asn_position[dbt]-2) << 2
+		db.asn_enabled = true
+	}
+	if as_position[dbt] != 0 {
+		db.as_position_offset = uint32(as_position[dbt]-2) << 2
+		db.as_enabled = true
+	}
 
 	db.metaok = true
 
@@ -472,23 +584,23 @@ func OpenDB(dbpath string) (*DB, error) {
 
 // Get_all will return all geolocation fields based on the queried IP address.
 func (d *DB) Get_all(ipaddress string) (IP2Locationrecord, error) {
-	return d.query(ipaddress, all)
+	x, _, err := d.query(ipaddress, all)
+	return x, err
 }
 
-// main query
-func (d *DB) query(ipaddress string, mode uint32) (IP2Locationrecord, error) {
-	x := IP2Locationrecord{} // default empty record
-
-	// read metadata
-	if !d.metaok {
-		return x, fmt.Errorf(missing_file)
-	}
+// getAllRange is Get_all that also returns the range of addresses sharing the record.
+func (d *DB) getAllRange(ipaddress string) (IP2Locationrecord, ipRange, error) {
+	return d.query(ipaddress, all)
+}
 
+// findrow runs the binary search for ipaddress and returns the matching row without the IP from column,
+// and the range of the row. A nil row and nil error means the address is not covered by the database.
+func (d *DB) findrow(ipaddress string) ([]byte, ipRange, error) {
 	// check IP type and return IP number & index (if exists)
 	iptype, ipno, ipindex := d.checkip(ipaddress)
 
 	if iptype == 0 {
-		return x, fmt.Errorf(invalid_address)
+		return nil, ipRange{}, fmt.Errorf(invalid_address)
 	}
 
 	var err error
@@ -499,9 +611,9 @@ func (d *DB) query(ipaddress string, mode uint32) (IP2Locationrecord, error) {
 	var mid uint32
 	var rowoffset uint32
 	var rowoffset2 uint32
-	ipfrom := big.NewInt(0)
-	ipto := big.NewInt(0)
-	maxip := big.NewInt(0)
+	var ipfrom uint128
+	var ipto uint128
+	var maxip uint128
 
 	if iptype == 4 {
 		baseaddr = d.meta.ipv4databaseaddr
@@ -519,16 +631,16 @@ func (d *DB) query(ipaddress string, mode uint32) (IP2Locationrecord, error) {
 	if ipindex > 0 {
 		low, err = d.readuint32(ipindex)
 		if err != nil {
-			return x, err
+			return nil, ipRange{}, err
 		}
 		high, err = d.readuint32(ipindex + 4)
 		if err != nil {
-			return x, err
+			return nil, ipRange{}, err
 		}
 	}
 
-	if ipno.Cmp(maxip) >= 0 {
-		ipno.Sub(ipno, big.NewInt(1))
+	if ipno.cmp(maxip) >= 0 {
+		ipno = ipno.dec()
 	}
 
 	for low <= high {
@@ -539,173 +651,221 @@ func (d *DB) query(ipaddress string, mode uint32) (IP2Locationrecord, error) {
 		if iptype == 4 {
 			ipfrom32, err := d.readuint32(rowoffset)
 			if err != nil {
-				return x, err
+				return nil, ipRange{}, err
 			}
-			ipfrom = big.NewInt(int64(ipfrom32))
+			ipfrom = uint128{lo: uint64(ipfrom32)}
 
 			ipto32, err := d.readuint32(rowoffset2)
 			if err != nil {
-				return x, err
+				return nil, ipRange{}, err
 			}
-			ipto = big.NewInt(int64(ipto32))
+			ipto = uint128{lo: uint64(ipto32)}
 
 		} else {
 			ipfrom, err = d.readuint128(rowoffset)
 			if err != nil {
-				return x, err
+				return nil, ipRange{}, err
 			}
 
 			ipto, err = d.readuint128(rowoffset2)
 			if err != nil {
-				return x, err
+				return nil, ipRange{}, err
 			}
 		}
 
-		if ipno.Cmp(ipfrom) >= 0 && ipno.Cmp(ipto) < 0 {
+		if ipno.cmp(ipfrom) >= 0 && ipno.cmp(ipto) < 0 {
 			var firstcol uint32 = 4 // 4 bytes for ip from
 			if iptype == 6 {
 				firstcol = 16 // 16 bytes for ipv6
 			}
 
-			row := make([]byte, colsize-firstcol) // exclude the ip from field
-			_, err := d.f.ReadAt(row, int64(rowoffset+firstcol-1))
+			// exclude the ip from field
+			row, err := d.readat(int64(rowoffset+firstcol-1), int(colsize-firstcol))
 			if err != nil {
-				return x, err
+				return nil, ipRange{}, err
 			}
-
-			if mode&countryshort == 1 && d.country_enabled {
-				if x.Country_short, err = d.readstr(d.readuint32_row(row, d.country_position_offset)); err != nil {
-					return x, err
-				}
+			return row, ipRange{iptype: iptype, from: ipfrom, to: ipto}, nil
+		} else {
+			if ipno.cmp(ipfrom) < 0 {
+				high = mid - 1
+			} else {
+				low = mid + 1
 			}
+		}
+	}
+	return nil, ipRange{}, nil
+}
 
-			if mode&countrylong != 0 && d.country_enabled {
-				if x.Country_long, err = d.readstr(d.readuint32_row(row, d.country_position_offset) + 3); err != nil {
-					return x, err
-				}
-			}
+// main query
+func (d *DB) query(ipaddress string, mode uint32) (IP2Locationrecord, ipRange, error) {
+	x := IP2Locationrecord{} // default empty record
 
-			if mode&region != 0 && d.region_enabled {
-				if x.Region, err = d.readstr(d.readuint32_row(row, d.region_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	// read metadata
+	if !d.metaok {
+		return x, ipRange{}, fmt.Errorf(missing_file)
+	}
 
-			if mode&city != 0 && d.city_enabled {
-				if x.City, err = d.readstr(d.readuint32_row(row, d.city_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	row, r, err := d.findrow(ipaddress)
+	if err != nil || row == nil {
+		return x, r, err
+	}
 
-			if mode&isp != 0 && d.isp_enabled {
-				if x.Isp, err = d.readstr(d.readuint32_row(row, d.isp_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&countryshort == 1 && d.country_enabled {
+		if x.Country_short, err = d.readstr(d.readuint32_row(row, d.country_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&latitude != 0 && d.latitude_enabled {
-				x.Latitude = d.readfloat_row(row, d.latitude_position_offset)
-			}
+	if mode&countrylong != 0 && d.country_enabled {
+		if x.Country_long, err = d.readstr(d.readuint32_row(row, d.country_position_offset) + 3); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&longitude != 0 && d.longitude_enabled {
-				x.Longitude = d.readfloat_row(row, d.longitude_position_offset)
-			}
+	if mode&region != 0 && d.region_enabled {
+		if x.Region, err = d.readstr(d.readuint32_row(row, d.region_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&domain != 0 && d.domain_enabled {
-				if x.Domain, err = d.readstr(d.readuint32_row(row, d.domain_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&city != 0 && d.city_enabled {
+		if x.City, err = d.readstr(d.readuint32_row(row, d.city_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&zipcode != 0 && d.zipcode_enabled {
-				if x.Zipcode, err = d.readstr(d.readuint32_row(row, d.zipcode_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&isp != 0 && d.isp_enabled {
+		if x.Isp, err = d.readstr(d.readuint32_row(row, d.isp_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&timezone != 0 && d.timezone_enabled {
-				if x.Timezone, err = d.readstr(d.readuint32_row(row, d.timezone_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&latitude != 0 && d.latitude_enabled {
+		x.Latitude = d.readfloat_row(row, d.latitude_position_offset)
+	}
 
-			if mode&netspeed != 0 && d.netspeed_enabled {
-				if x.Netspeed, err = d.readstr(d.readuint32_row(row, d.netspeed_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&longitude != 0 && d.longitude_enabled {
+		x.Longitude = d.readfloat_row(row, d.longitude_position_offset)
+	}
 
-			if mode&iddcode != 0 && d.iddcode_enabled {
-				if x.Iddcode, err = d.readstr(d.readuint32_row(row, d.iddcode_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&domain != 0 && d.domain_enabled {
+		if x.Domain, err = d.readstr(d.readuint32_row(row, d.domain_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&areacode != 0 && d.areacode_enabled {
-				if x.Areacode, err = d.readstr(d.readuint32_row(row, d.areacode_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&zipcode != 0 && d.zipcode_enabled {
+		if x.Zipcode, err = d.readstr(d.readuint32_row(row, d.zipcode_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&weatherstationcode != 0 && d.weatherstationcode_enabled {
-				if x.Weatherstationcode, err = d.readstr(d.readuint32_row(row, d.weatherstationcode_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&timezone != 0 && d.timezone_enabled {
+		if x.Timezone, err = d.readstr(d.readuint32_row(row, d.timezone_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&weatherstationname != 0 && d.weatherstationname_enabled {
-				if x.Weatherstationname, err = d.readstr(d.readuint32_row(row, d.weatherstationname_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&netspeed != 0 && d.netspeed_enabled {
+		if x.Netspeed, err = d.readstr(d.readuint32_row(row, d.netspeed_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&mcc != 0 && d.mcc_enabled {
-				if x.Mcc, err = d.readstr(d.readuint32_row(row, d.mcc_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&iddcode != 0 && d.iddcode_enabled {
+		if x.Iddcode, err = d.readstr(d.readuint32_row(row, d.iddcode_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&mnc != 0 && d.mnc_enabled {
-				if x.Mnc, err = d.readstr(d.readuint32_row(row, d.mnc_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&areacode != 0 && d.areacode_enabled {
+		if x.Areacode, err = d.readstr(d.readuint32_row(row, d.areacode_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&mobilebrand != 0 && d.mobilebrand_enabled {
-				if x.Mobilebrand, err = d.readstr(d.readuint32_row(row, d.mobilebrand_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&weatherstationcode != 0 && d.weatherstationcode_enabled {
+		if x.Weatherstationcode, err = d.readstr(d.readuint32_row(row, d.weatherstationcode_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&elevation != 0 && d.elevation_enabled {
-				res, err := d.readstr(d.readuint32_row(row, d.elevation_position_offset))
-				if err != nil {
-					return x, err
-				}
+	if mode&weatherstationname != 0 && d.weatherstationname_enabled {
+		if x.Weatherstationname, err = d.readstr(d.readuint32_row(row, d.weatherstationname_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-				f, _ := strconv.ParseFloat(res, 32)
-				x.Elevation = float32(f)
-			}
+	if mode&mcc != 0 && d.mcc_enabled {
+		if x.Mcc, err = d.readstr(d.readuint32_row(row, d.mcc_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			if mode&usagetype != 0 && d.usagetype_enabled {
-				if x.Usagetype, err = d.readstr(d.readuint32_row(row, d.usagetype_position_offset)); err != nil {
-					return x, err
-				}
-			}
+	if mode&mnc != 0 && d.mnc_enabled {
+		if x.Mnc, err = d.readstr(d.readuint32_row(row, d.mnc_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
 
-			return x, nil
-		} else {
-			if ipno.Cmp(ipfrom) < 0 {
-				high = mid - 1
-			} else {
-				low = mid + 1
-			}
+	if mode&mobilebrand != 0 && d.mobilebrand_enabled {
+		if x.Mobilebrand, err = d.readstr(d.readuint32_row(row, d.mobilebrand_position_offset)); err != nil {
+			return x, r, err
 		}
 	}
-	return x, nil
+
+	if mode&elevation != 0 && d.elevation_enabled {
+		res, err := d.readstr(d.readuint32_row(row, d.elevation_position_offset))
+		if err != nil {
+			return x, r, err
+		}
+
+		f, _ := strconv.ParseFloat(res, 32)
+		x.Elevation = float32(f)
+	}
+
+	if mode&usagetype != 0 && d.usagetype_enabled {
+		if x.Usagetype, err = d.readstr(d.readuint32_row(row, d.usagetype_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
+
+	if mode&addresstype != 0 && d.addresstype_enabled {
+		if x.Addresstype, err = d.readstr(d.readuint32_row(row, d.addresstype_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
+
+	if mode&category != 0 && d.category_enabled {
+		if x.Category, err = d.readstr(d.readuint32_row(row, d.category_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
+
+	if mode&district != 0 && d.district_enabled {
+		if x.District, err = d.readstr(d.readuint32_row(row, d.district_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
+
+	if mode&asn != 0 && d.asn_enabled {
+		if x.Asn, err = d.readstr(d.readuint32_row(row, d.asn_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
+
+	if mode&as != 0 && d.as_enabled {
+		if x.As, err = d.readstr(d.readuint32_row(row, d.as_position_offset)); err != nil {
+			return x, r, err
+		}
+	}
+
+	return x, r, nil
 }
 
 func (d *DB) Close() {
-	_ = d.f.Close()
+	if d.f != nil {
+		_ = d.f.Close()
+	}
+	d.buf = nil
 }
-
@@ -0,0 +1,360 @@
+package traefik_plugin_ip2location
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// testBINRow is one IPv4 range of a test BIN file. The range runs from the
+// from address up to the from address of the next row.
+type testBINRow struct {
+	from   string
+	fields map[string]string
+}
+
+// testBINColumn is a field name and its column position table.
+type testBINColumn struct {
+	name      string
+	positions []uint8
+}
+
+// testBINColumns lists the IP2Location column position tables by field name.
+func testBINColumns() []testBINColumn {
+	return []testBINColumn{
+		{"country", country_position[:]},
+		{"region", region_position[:]},
+		{"city", city_position[:]},
+		{"isp", isp_position[:]},
+		{"latitude", latitude_position[:]},
+		{"longitude", longitude_position[:]},
+		{"domain", domain_position[:]},
+		{"zipcode", zipcode_position[:]},
+		{"timezone", timezone_position[:]},
+		{"netspeed", netspeed_position[:]},
+		{"iddcode", iddcode_position[:]},
+		{"areacode", areacode_position[:]},
+		{"weatherstationcode", weatherstationcode_position[:]},
+		{"weatherstationname", weatherstationname_position[:]},
+		{"mcc", mcc_position[:]},
+		{"mnc", mnc_position[:]},
+		{"mobilebrand", mobilebrand_position[:]},
+		{"elevation", elevation_position[:]},
+		{"usagetype", usagetype_position[:]},
+		{"addresstype", addresstype_position[:]},
+		{"category", category_position[:]},
+		{"district", district_position[:]},
+		{"asn", asn_position[:]},
+		{"as", as_position[:]},
+	}
+}
+
+// buildTestBIN writes an IPv4-only IP2Location BIN file of the given database
+// type and returns its path. Rows must be sorted by their from address.
+func buildTestBIN(t testing.TB, dbtype uint8, rows []testBINRow) string {
+	t.Helper()
+	return buildTestBINFile(t, ip2location_productcode, dbtype, testBINColumns(), rows)
+}
+
+// buildTestBINFile writes an IPv4-only BIN file with the given product code
+// and column layout and returns its path.
+func buildTestBINFile(t testing.TB, productcode, dbtype uint8, layout []testBINColumn, rows []testBINRow) string {
+	t.Helper()
+
+	if len(rows) == 0 || rows[0].from != "0.0.0.0" {
+		rows = append([]testBINRow{{from: "0.0.0.0"}}, rows...)
+	}
+
+	columns := uint8(1)
+	for _, c := range layout {
+		if c.positions[dbtype] > columns {
+			columns = c.positions[dbtype]
+		}
+	}
+
+	const headerSize = 64
+	colsize := uint32(columns) * 4
+	// one extra row holds the upper bound of the last range
+	stringsStart := headerSize + colsize*uint32(len(rows)+1)
+
+	var strs []byte
+	addString := func(v string) uint32 {
+		pos := stringsStart + uint32(len(strs))
+		strs = append(strs, byte(len(v)))
+		strs = append(strs, v...)
+		return pos
+	}
+
+	var table []byte
+	for _, row := range rows {
+		col := make([]byte, colsize)
+		binary.LittleEndian.PutUint32(col, binary.BigEndian.Uint32(net.ParseIP(row.from).To4()))
+		for _, c := range layout {
+			p := c.positions[dbtype]
+			if p == 0 {
+				continue
+			}
+			off := (uint32(p) - 1) * 4
+			var v uint32
+			switch c.name {
+			case "country":
+				short := row.fields["country_short"]
+				if short == "" {
+					short = "-"
+				}
+				// the long name is read 3 bytes after the short code
+				v = addString(short)
+				for i := len(short); i < 2; i++ {
+					strs = append(strs, 0)
+				}
+				addString(row.fields["country_long"])
+			case "latitude", "longitude":
+				f, _ := strconv.ParseFloat(row.fields[c.name], 32)
+				v = math.Float32bits(float32(f))
+			default:
+				v = addString(row.fields[c.name])
+			}
+			binary.LittleEndian.PutUint32(col[off:], v)
+		}
+		table = append(table, col...)
+	}
+	last := make([]byte, colsize)
+	binary.LittleEndian.PutUint32(last, math.MaxUint32)
+	table = append(table, last...)
+
+	header := make([]byte, headerSize)
+	header[0] = dbtype
+	header[1] = columns
+	header[2] = 24 // year
+	header[3] = 1  // month
+	header[4] = 1  // day
+	binary.LittleEndian.PutUint32(header[5:], uint32(len(rows)))
+	binary.LittleEndian.PutUint32(header[9:], headerSize+1)
+	header[29] = productcode
+
+	buf := append(header, table...)
+	buf = append(buf, strs...)
+
+	path := filepath.Join(t.TempDir(), "TEST-"+strconv.Itoa(int(productcode))+"-DB"+strconv.Itoa(int(dbtype))+".BIN")
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDB_GetAll(t *testing.T) {
+	path := buildTestBIN(t, 24, []testBINRow{
+		{from: "0.0.0.0"},
+		{from: "8.8.8.0", fields: map[string]string{
+			"country_short": "US",
+			"country_long":  "United States of America",
+			"region":        "California",
+			"city":          "Mountain View",
+			"isp":           "Google LLC",
+			"latitude":      "37.405991",
+			"longitude":     "-122.078514",
+			"netspeed":      "T1",
+			"mcc":           "-",
+			"elevation":     "32",
+			"usagetype":     "DCH",
+		}},
+		{from: "8.8.9.0"},
+	})
+
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	record, err := db.Get_all("8.8.8.8")
+	if err != nil {
+		t.Fatalf("Get_all failed: %v", err)
+	}
+	if record.Country_short != "US" || record.Country_long != "United States of America" {
+		t.Errorf("unexpected country: %q %q", record.Country_short, record.Country_long)
+	}
+	if record.City != "Mountain View" || record.Isp != "Google LLC" {
+		t.Errorf("unexpected city/isp: %q %q", record.City, record.Isp)
+	}
+	if record.Latitude < 37.40 || record.Latitude > 37.41 {
+		t.Errorf("unexpected latitude: %v", record.Latitude)
+	}
+	if record.Netspeed != "T1" || record.Usagetype != "DCH" || record.Elevation != 32 {
+		t.Errorf("unexpected netspeed/usagetype/elevation: %q %q %v", record.Netspeed, record.Usagetype, record.Elevation)
+	}
+
+	record, err = db.Get_all("8.8.9.1")
+	if err != nil {
+		t.Fatalf("Get_all failed: %v", err)
+	}
+	if record.Country_short != "-" {
+		t.Errorf("expected unallocated record, got %q", record.Country_short)
+	}
+}
+
+func TestDB_GetAllDB26(t *testing.T) {
+	path := buildTestBIN(t, 26, []testBINRow{
+		{from: "8.8.8.0", fields: map[string]string{
+			"country_short": "US",
+			"usagetype":     "DCH",
+			"addresstype":   "U",
+			"category":      "IAB19-11",
+			"district":      "Santa Clara County",
+			"asn":           "15169",
+			"as":            "Google LLC",
+		}},
+		{from: "8.8.9.0"},
+	})
+
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	record, err := db.Get_all("8.8.8.8")
+	if err != nil {
+		t.Fatalf("Get_all failed: %v", err)
+	}
+	if record.Usagetype != "DCH" || record.Addresstype != "U" || record.Category != "IAB19-11" {
+		t.Errorf("unexpected usagetype/addresstype/category: %q %q %q", record.Usagetype, record.Addresstype, record.Category)
+	}
+	if record.District != "Santa Clara County" || record.Asn != "15169" || record.As != "Google LLC" {
+		t.Errorf("unexpected district/asn/as: %q %q %q", record.District, record.Asn, record.As)
+	}
+}
+
+func TestDB_UnsupportedType(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "IP2LOCATION-FUTURE.BIN")
+	header := make([]byte, 64)
+	header[0] = 99
+	if err := os.WriteFile(path, header, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenDB(path); err == nil {
+		t.Fatal("Expected error for unsupported database type")
+	}
+}
+
+func TestDB_GetAllInMemory(t *testing.T) {
+	path := buildTestBIN(t, 11, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{
+			"country_short": "GB",
+			"country_long":  "United Kingdom",
+			"city":          "London",
+			"latitude":      "51.5142",
+		}},
+		{from: "81.2.70.0"},
+	})
+
+	fileDB, err := OpenDB(path)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer fileDB.Close()
+
+	memDB, err := OpenDBInMemory(path)
+	if err != nil {
+		t.Fatalf("OpenDBInMemory failed: %v", err)
+	}
+	defer memDB.Close()
+
+	for _, ip := range []string{"81.2.69.160", "81.2.70.1", "0.0.0.1", "255.255.255.255", "::ffff:81.2.69.160", "2002:5102:45a0::1"} {
+		want, err := fileDB.Get_all(ip)
+		if err != nil {
+			t.Fatalf("Get_all(%s) failed: %v", ip, err)
+		}
+		got, err := memDB.Get_all(ip)
+		if err != nil {
+			t.Fatalf("in-memory Get_all(%s) failed: %v", ip, err)
+		}
+		if got != want {
+			t.Errorf("Get_all(%s) = %+v, want %+v", ip, got, want)
+		}
+	}
+
+	record, _ := memDB.Get_all("2002:5102:45a0::1")
+	if record.City != "London" {
+		t.Errorf("expected 6to4 address to resolve to London, got %q", record.City)
+	}
+}
+
+func TestDB_CheckIP(t *testing.T) {
+	d := &DB{}
+	tests := []struct {
+		ip     string
+		iptype uint32
+		ipnum  uint128
+	}{
+		{"81.2.69.160", 4, uint128{lo: 0x510245a0}},
+		{"::ffff:81.2.69.160", 4, uint128{lo: 0x510245a0}},
+		{"2002:5102:45a0::1", 4, uint128{lo: 0x510245a0}},
+		{"2001:0:4136:e378:8000:63bf:aefd:bc5f", 4, uint128{lo: 0x510243a0}},
+		{"2001:db8::1", 6, uint128{hi: 0x20010db800000000, lo: 1}},
+		{"not an ip", 0, uint128{}},
+	}
+	for _, tt := range tests {
+		iptype, ipnum, _ := d.checkip(tt.ip)
+		if iptype != tt.iptype || ipnum != tt.ipnum {
+			t.Errorf("checkip(%s) = %d %+v, want %d %+v", tt.ip, iptype, ipnum, tt.iptype, tt.ipnum)
+		}
+	}
+}
+
+// benchmarkBIN writes a DB11 test file with enough ranges for the binary
+// search to take a realistic number of steps.
+func benchmarkBIN(b *testing.B) string {
+	b.Helper()
+	rows := make([]testBINRow, 0, 4096)
+	for i := 0; i < 4096; i++ {
+		rows = append(rows, testBINRow{from: net.IPv4(byte(i>>4), byte(i<<4), 0, 0).String(), fields: map[string]string{
+			"country_short": "US",
+			"country_long":  "United States of America",
+			"region":        "California",
+			"city":          "Mountain View",
+			"latitude":      "37.405991",
+			"longitude":     "-122.078514",
+			"zipcode":       "94043",
+			"timezone":      "-07:00",
+		}})
+	}
+	return buildTestBIN(b, 11, rows)
+}
+
+func BenchmarkDB_GetAll(b *testing.B) {
+	db, err := OpenDB(benchmarkBIN(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.Get_all("81.2.69.160"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDB_GetAllInMemory(b *testing.B) {
+	db, err := OpenDBInMemory(benchmarkBIN(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.Get_all("81.2.69.160"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
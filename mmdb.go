@@ -0,0 +1,594 @@
+package traefik_plugin_ip2location
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"strconv"
+)
+
+// MaxMind DB format: https://maxmind.github.io/MaxMind-DB/
+//
+// The reader below is a dependency-free implementation of version 2 of the
+// format. The whole file is loaded into memory, which keeps lookups free of
+// syscalls and works under Yaegi where mmap is not available.
+
+// mmdbMetadataMarker precedes the metadata map at the end of the file.
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbMetadataMaxSize is how far from the end of the file the marker may be.
+const mmdbMetadataMaxSize = 128 * 1024
+
+// mmdbDataSectionSeparator is the number of zero bytes between the search tree
+// and the data section.
+const mmdbDataSectionSeparator = 16
+
+// mmdbMaxDepth bounds recursion while decoding nested maps, arrays and pointers.
+const mmdbMaxDepth = 64
+
+// data section field types
+const (
+	mmdbExtended  = 0
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEndMarker = 13
+	mmdbBool      = 14
+	mmdbFloat     = 15
+)
+
+type mmdbMetadata struct {
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+	buildEpoch   uint64
+}
+
+// MMDB is a reader for MaxMind DB files such as GeoLite2-City or GeoLite2-ASN.
+type MMDB struct {
+	buf       []byte
+	meta      mmdbMetadata
+	data      mmdbDecoder
+	ipv4Start uint
+}
+
+// MMDBNames holds localized names keyed by language code (e.g. "en").
+type MMDBNames map[string]string
+
+// MMDBContinent is the continent block of a GeoIP2 record.
+type MMDBContinent struct {
+	Code  string
+	Names MMDBNames
+}
+
+// MMDBCountry is the country block of a GeoIP2 record.
+type MMDBCountry struct {
+	IsoCode string
+	Names   MMDBNames
+}
+
+// MMDBSubdivision is one entry of the subdivisions list of a GeoIP2 record.
+type MMDBSubdivision struct {
+	IsoCode string
+	Names   MMDBNames
+}
+
+// MMDBCity is the city block of a GeoIP2 record.
+type MMDBCity struct {
+	Names MMDBNames
+}
+
+// MMDBPostal is the postal block of a GeoIP2 record.
+type MMDBPostal struct {
+	Code string
+}
+
+// MMDBLocation is the location block of a GeoIP2 record.
+type MMDBLocation struct {
+	Latitude       float64
+	Longitude      float64
+	TimeZone       string
+	AccuracyRadius uint
+}
+
+// MMDBTraits is the traits block of a GeoIP2 record. The top-level fields of
+// the ASN, ISP, Domain and Connection-Type databases are folded in here too.
+type MMDBTraits struct {
+	AutonomousSystemNumber       uint
+	AutonomousSystemOrganization string
+	ISP                          string
+	Organization                 string
+	Domain                       string
+	ConnectionType               string
+	UserType                     string
+}
+
+// MMDBRecord stores the fields the plugin understands from a MaxMind DB record.
+type MMDBRecord struct {
+	Continent    MMDBContinent
+	Country      MMDBCountry
+	Subdivisions []MMDBSubdivision
+	City         MMDBCity
+	Postal       MMDBPostal
+	Location     MMDBLocation
+	Traits       MMDBTraits
+}
+
+// OpenMMDB reads the MaxMind DB file at dbpath into memory and validates its metadata.
+func OpenMMDB(dbpath string) (*MMDB, error) {
+	buf, err := os.ReadFile(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	return newMMDB(buf)
+}
+
+func newMMDB(buf []byte) (*MMDB, error) {
+	start := len(buf) - mmdbMetadataMaxSize
+	if start < 0 {
+		start = 0
+	}
+	idx := bytes.LastIndex(buf[start:], mmdbMetadataMarker)
+	if idx < 0 {
+		return nil, fmt.Errorf("invalid MMDB file: metadata marker not found")
+	}
+	metaStart := start + idx + len(mmdbMetadataMarker)
+
+	metaDecoder := mmdbDecoder{buf: buf[metaStart:]}
+	raw, _, err := metaDecoder.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MMDB metadata: %w", err)
+	}
+	fields, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid MMDB metadata: not a map")
+	}
+
+	db := &MMDB{buf: buf}
+	db.meta.nodeCount = uint(mmdbUintField(fields, "node_count"))
+	db.meta.recordSize = uint(mmdbUintField(fields, "record_size"))
+	db.meta.ipVersion = uint(mmdbUintField(fields, "ip_version"))
+	db.meta.databaseType = mmdbStringField(fields, "database_type")
+	db.meta.buildEpoch = mmdbUintField(fields, "build_epoch")
+
+	if major := mmdbUintField(fields, "binary_format_major_version"); major != 2 {
+		return nil, fmt.Errorf("unsupported MMDB binary format version %d", major)
+	}
+	switch db.meta.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported MMDB record size %d", db.meta.recordSize)
+	}
+	if db.meta.ipVersion != 4 && db.meta.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported MMDB ip version %d", db.meta.ipVersion)
+	}
+
+	treeSize := db.meta.nodeCount * db.meta.recordSize / 4
+	dataStart := treeSize + mmdbDataSectionSeparator
+	if dataStart > uint(start+idx) {
+		return nil, fmt.Errorf("invalid MMDB file: search tree exceeds file size")
+	}
+	db.data = mmdbDecoder{buf: buf[dataStart : start+idx]}
+
+	// IPv4 addresses live under ::/96 in IPv6 trees.
+	if db.meta.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.meta.nodeCount; i++ {
+			node = db.readNode(node, 0)
+		}
+		db.ipv4Start = node
+	}
+
+	return db, nil
+}
+
+// DatabaseType returns the database_type metadata value, e.g. "GeoLite2-City".
+func (m *MMDB) DatabaseType() string {
+	return m.meta.databaseType
+}
+
+// readNode returns the left (bit 0) or right (bit 1) record of a search tree node.
+func (m *MMDB) readNode(node uint, bit byte) uint {
+	base := node * m.meta.recordSize / 4
+	b := m.buf
+	switch m.meta.recordSize {
+	case 24:
+		off := base + uint(bit)*3
+		return uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+	case 28:
+		if bit == 0 {
+			return (uint(b[base+3])&0xF0)<<20 | uint(b[base])<<16 | uint(b[base+1])<<8 | uint(b[base+2])
+		}
+		return (uint(b[base+3])&0x0F)<<24 | uint(b[base+4])<<16 | uint(b[base+5])<<8 | uint(b[base+6])
+	default:
+		off := base + uint(bit)*4
+		return uint(binary.BigEndian.Uint32(b[off : off+4]))
+	}
+}
+
+// lookupOffset walks the search tree and returns the data section offset for ip.
+func (m *MMDB) lookupOffset(ip net.IP) (uint, bool, error) {
+	bits := ip.To16()
+	if bits == nil {
+		return 0, false, fmt.Errorf(invalid_address)
+	}
+	bitCount := 128
+	node := uint(0)
+	if v4 := ip.To4(); v4 != nil {
+		bits = v4
+		bitCount = 32
+		node = m.ipv4Start
+	} else if m.meta.ipVersion == 4 {
+		return 0, false, fmt.Errorf("cannot look up IPv6 address %s in an IPv4-only MMDB file", ip)
+	}
+
+	for i := 0; i < bitCount && node < m.meta.nodeCount; i++ {
+		bit := (bits[i>>3] >> (7 - uint(i&7))) & 1
+		node = m.readNode(node, bit)
+	}
+
+	if node == m.meta.nodeCount {
+		return 0, false, nil
+	}
+	if node < m.meta.nodeCount {
+		return 0, false, fmt.Errorf("invalid MMDB search tree")
+	}
+	offset := node - m.meta.nodeCount - mmdbDataSectionSeparator
+	if offset >= uint(len(m.data.buf)) {
+		return 0, false, fmt.Errorf("invalid MMDB data pointer")
+	}
+	return offset, true, nil
+}
+
+// LookupIP returns the record for ip. An address that is not in the database
+// yields an empty record and no error.
+func (m *MMDB) LookupIP(ip net.IP) (MMDBRecord, error) {
+	var record MMDBRecord
+
+	offset, found, err := m.lookupOffset(ip)
+	if err != nil || !found {
+		return record, err
+	}
+
+	raw, _, err := m.data.decode(offset, 0)
+	if err != nil {
+		return record, err
+	}
+	fields, ok := raw.(map[string]interface{})
+	if !ok {
+		return record, fmt.Errorf("invalid MMDB record: not a map")
+	}
+
+	continent := mmdbMapField(fields, "continent")
+	record.Continent.Code = mmdbStringField(continent, "code")
+	record.Continent.Names = mmdbNamesField(continent)
+
+	country := mmdbMapField(fields, "country")
+	record.Country.IsoCode = mmdbStringField(country, "iso_code")
+	record.Country.Names = mmdbNamesField(country)
+
+	if subdivisions, ok := fields["subdivisions"].([]interface{}); ok {
+		for _, s := range subdivisions {
+			sub, _ := s.(map[string]interface{})
+			record.Subdivisions = append(record.Subdivisions, MMDBSubdivision{
+				IsoCode: mmdbStringField(sub, "iso_code"),
+				Names:   mmdbNamesField(sub),
+			})
+		}
+	}
+
+	record.City.Names = mmdbNamesField(mmdbMapField(fields, "city"))
+	record.Postal.Code = mmdbStringField(mmdbMapField(fields, "postal"), "code")
+
+	location := mmdbMapField(fields, "location")
+	record.Location.Latitude = mmdbFloatField(location, "latitude")
+	record.Location.Longitude = mmdbFloatField(location, "longitude")
+	record.Location.TimeZone = mmdbStringField(location, "time_zone")
+	record.Location.AccuracyRadius = uint(mmdbUintField(location, "accuracy_radius"))
+
+	// City/Enterprise databases nest these under traits, the ASN, ISP,
+	// Domain and Connection-Type databases store them at the top level.
+	for _, src := range []map[string]interface{}{fields, mmdbMapField(fields, "traits")} {
+		if v := mmdbUintField(src, "autonomous_system_number"); v != 0 {
+			record.Traits.AutonomousSystemNumber = uint(v)
+		}
+		if v := mmdbStringField(src, "autonomous_system_organization"); v != "" {
+			record.Traits.AutonomousSystemOrganization = v
+		}
+		if v := mmdbStringField(src, "isp"); v != "" {
+			record.Traits.ISP = v
+		}
+		if v := mmdbStringField(src, "organization"); v != "" {
+			record.Traits.Organization = v
+		}
+		if v := mmdbStringField(src, "domain"); v != "" {
+			record.Traits.Domain = v
+		}
+		if v := mmdbStringField(src, "connection_type"); v != "" {
+			record.Traits.ConnectionType = v
+		}
+		if v := mmdbStringField(src, "user_type"); v != "" {
+			record.Traits.UserType = v
+		}
+	}
+
+	return record, nil
+}
+
+// Get_all looks up ipaddress and maps the result onto an IP2Locationrecord so
+// the MMDB reader can be used wherever a *DB is.
+func (m *MMDB) Get_all(ipaddress string) (IP2Locationrecord, error) {
+	x := IP2Locationrecord{}
+
+	ip := net.ParseIP(ipaddress)
+	if ip == nil {
+		return x, fmt.Errorf(invalid_address)
+	}
+
+	record, err := m.LookupIP(ip)
+	if err != nil {
+		return x, err
+	}
+
+	x.Country_short = record.Country.IsoCode
+	x.Country_long = record.Country.Names["en"]
+	x.Continentcode = record.Continent.Code
+	x.Continentname = record.Continent.Names["en"]
+	if len(record.Subdivisions) > 0 {
+		x.Region = record.Subdivisions[0].Names["en"]
+		x.Regioncode = record.Subdivisions[0].IsoCode
+	}
+	x.City = record.City.Names["en"]
+	x.Zipcode = record.Postal.Code
+	x.Latitude = float32(record.Location.Latitude)
+	x.Longitude = float32(record.Location.Longitude)
+	x.Timezone = record.Location.TimeZone
+	x.Accuracyradius = uint16(record.Location.AccuracyRadius)
+	x.Isp = record.Traits.ISP
+	x.Domain = record.Traits.Domain
+	x.Netspeed = record.Traits.ConnectionType
+	x.Usagetype = record.Traits.UserType
+	if record.Traits.AutonomousSystemNumber != 0 {
+		x.Asn = strconv.FormatUint(uint64(record.Traits.AutonomousSystemNumber), 10)
+	}
+	x.As = record.Traits.AutonomousSystemOrganization
+
+	return x, nil
+}
+
+// Close releases the in-memory copy of the database.
+func (m *MMDB) Close() {
+	m.buf = nil
+	m.data.buf = nil
+}
+
+// mmdbDecoder decodes values from the data (or metadata) section.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+func (d *mmdbDecoder) corrupt(offset uint) error {
+	return fmt.Errorf("invalid MMDB data at offset %d", offset)
+}
+
+// decode decodes the value at offset and returns it along with the offset of
+// the next value. Pointers are followed transparently.
+func (d *mmdbDecoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("invalid MMDB data: maximum nesting depth exceeded")
+	}
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, d.corrupt(offset)
+	}
+
+	ctrl := d.buf[offset]
+	offset++
+	typeNum := uint(ctrl >> 5)
+
+	if typeNum == mmdbPointer {
+		target, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(target, depth+1)
+		return value, next, err
+	}
+
+	if typeNum == mmdbExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, d.corrupt(offset)
+		}
+		typeNum = 7 + uint(d.buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return nil, 0, d.corrupt(offset)
+		}
+		extra := uint(0)
+		for _, b := range d.buf[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		switch size {
+		case 29:
+			size = 29 + extra
+		case 30:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	return d.decodeValue(typeNum, size, offset, depth)
+}
+
+// pointer resolves a pointer control byte into a data section offset.
+func (d *mmdbDecoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint((ctrl>>3)&0x3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, d.corrupt(offset)
+	}
+	prefix := uint(ctrl & 0x7)
+	if n == 4 {
+		prefix = 0
+	}
+	v := prefix
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
+
+func (d *mmdbDecoder) decodeValue(typeNum, size, offset uint, depth int) (interface{}, uint, error) {
+	switch typeNum {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("invalid MMDB data: map key is not a string")
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, d.corrupt(offset)
+	}
+	raw := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typeNum {
+	case mmdbString:
+		return string(raw), next, nil
+	case mmdbBytes:
+		return append([]byte(nil), raw...), next, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, d.corrupt(offset)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), next, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, d.corrupt(offset)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), next, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		if size > 8 {
+			return nil, 0, d.corrupt(offset)
+		}
+		v := uint64(0)
+		for _, b := range raw {
+			v = v<<8 | uint64(b)
+		}
+		return v, next, nil
+	case mmdbInt32:
+		if size > 4 {
+			return nil, 0, d.corrupt(offset)
+		}
+		v := uint32(0)
+		for _, b := range raw {
+			v = v<<8 | uint32(b)
+		}
+		return int64(int32(v)), next, nil
+	case mmdbUint128:
+		if size > 16 {
+			return nil, 0, d.corrupt(offset)
+		}
+		return new(big.Int).SetBytes(raw), next, nil
+	}
+
+	return nil, 0, fmt.Errorf("invalid MMDB data: unknown type %d", typeNum)
+}
+
+// helpers for reading decoded maps; missing or mistyped fields yield zero values
+
+func mmdbMapField(m map[string]interface{}, key string) map[string]interface{} {
+	v, _ := m[key].(map[string]interface{})
+	return v
+}
+
+func mmdbStringField(m map[string]interface{}, key string) string {
+	v, _ := m[key].(string)
+	return v
+}
+
+func mmdbUintField(m map[string]interface{}, key string) uint64 {
+	switch v := m[key].(type) {
+	case uint64:
+		return v
+	case int64:
+		if v > 0 {
+			return uint64(v)
+		}
+	}
+	return 0
+}
+
+func mmdbFloatField(m map[string]interface{}, key string) float64 {
+	v, _ := m[key].(float64)
+	return v
+}
+
+func mmdbNamesField(m map[string]interface{}) MMDBNames {
+	raw := mmdbMapField(m, "names")
+	if raw == nil {
+		return nil
+	}
+	names := make(MMDBNames, len(raw))
+	for lang, name := range raw {
+		if s, ok := name.(string); ok {
+			names[lang] = s
+		}
+	}
+	return names
+}
@@ -0,0 +1,304 @@
+package traefik_plugin_ip2location
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// testMMDBNode is a search tree node used by buildTestMMDB.
+type testMMDBNode struct {
+	child  [2]*testMMDBNode
+	leaf   bool
+	offset uint
+}
+
+// encodeTestMMDBCtrl encodes a control byte (and extended type / size bytes).
+func encodeTestMMDBCtrl(typeNum int, size int) []byte {
+	var out []byte
+	sizeBits := size
+	var extra []byte
+	switch {
+	case size >= 65821:
+		sizeBits = 31
+		v := size - 65821
+		extra = []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	case size >= 285:
+		sizeBits = 30
+		v := size - 285
+		extra = []byte{byte(v >> 8), byte(v)}
+	case size >= 29:
+		sizeBits = 29
+		extra = []byte{byte(size - 29)}
+	}
+	if typeNum <= 7 {
+		out = append(out, byte(typeNum<<5|sizeBits))
+	} else {
+		out = append(out, byte(sizeBits), byte(typeNum-7))
+	}
+	return append(out, extra...)
+}
+
+// encodeTestMMDBValue encodes a value into the MaxMind DB data section format.
+func encodeTestMMDBValue(v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return append(encodeTestMMDBCtrl(mmdbString, len(v)), v...)
+	case float64:
+		out := encodeTestMMDBCtrl(mmdbDouble, 8)
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+		return append(out, b[:]...)
+	case uint16:
+		out := encodeTestMMDBCtrl(mmdbUint16, 2)
+		return append(out, byte(v>>8), byte(v))
+	case uint32:
+		out := encodeTestMMDBCtrl(mmdbUint32, 4)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], v)
+		return append(out, b[:]...)
+	case uint64:
+		out := encodeTestMMDBCtrl(mmdbUint64, 8)
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], v)
+		return append(out, b[:]...)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		return encodeTestMMDBCtrl(mmdbBool, size)
+	case []interface{}:
+		out := encodeTestMMDBCtrl(mmdbArray, len(v))
+		for _, e := range v {
+			out = append(out, encodeTestMMDBValue(e)...)
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := encodeTestMMDBCtrl(mmdbMap, len(v))
+		for _, k := range keys {
+			out = append(out, encodeTestMMDBValue(k)...)
+			out = append(out, encodeTestMMDBValue(v[k])...)
+		}
+		return out
+	}
+	panic("unsupported test MMDB value")
+}
+
+// buildTestMMDB builds an IPv6 MaxMind DB with 24-bit records mapping each
+// CIDR to its record. IPv4 networks are stored under ::/96.
+func buildTestMMDB(t *testing.T, networks map[string]map[string]interface{}) []byte {
+	t.Helper()
+
+	root := &testMMDBNode{}
+	var data []byte
+
+	cidrs := make([]string, 0, len(networks))
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("bad test CIDR %s: %v", cidr, err)
+		}
+		ones, bits := ipNet.Mask.Size()
+		ip := ipNet.IP.To16()
+		if bits == 32 {
+			ip = make(net.IP, 16)
+			copy(ip[12:], ipNet.IP.To4())
+			ones += 96
+		}
+
+		offset := uint(len(data))
+		data = append(data, encodeTestMMDBValue(networks[cidr])...)
+
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := (ip[i>>3] >> (7 - uint(i&7))) & 1
+			if i == ones-1 {
+				node.child[bit] = &testMMDBNode{leaf: true, offset: offset}
+				break
+			}
+			if node.child[bit] == nil {
+				node.child[bit] = &testMMDBNode{}
+			}
+			node = node.child[bit]
+		}
+	}
+
+	// number internal nodes depth first
+	var order []*testMMDBNode
+	index := map[*testMMDBNode]uint{}
+	var walk func(n *testMMDBNode)
+	walk = func(n *testMMDBNode) {
+		index[n] = uint(len(order))
+		order = append(order, n)
+		for _, c := range n.child {
+			if c != nil && !c.leaf {
+				walk(c)
+			}
+		}
+	}
+	walk(root)
+	nodeCount := uint(len(order))
+
+	var tree []byte
+	for _, n := range order {
+		for _, c := range n.child {
+			value := nodeCount
+			if c != nil && c.leaf {
+				value = nodeCount + mmdbDataSectionSeparator + c.offset
+			} else if c != nil {
+				value = index[c]
+			}
+			tree = append(tree, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+
+	out := append(tree, make([]byte, mmdbDataSectionSeparator)...)
+	out = append(out, data...)
+	out = append(out, mmdbMetadataMarker...)
+	out = append(out, encodeTestMMDBValue(map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(6),
+		"database_type":               "Test-City",
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"languages":                   []interface{}{"en"},
+	})...)
+	return out
+}
+
+func testMMDBNetworks() map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		"81.2.69.0/24": {
+			"continent": map[string]interface{}{"code": "EU", "names": map[string]interface{}{"en": "Europe"}},
+			"country":   map[string]interface{}{"iso_code": "GB", "names": map[string]interface{}{"en": "United Kingdom", "de": "Vereinigtes Königreich"}},
+			"subdivisions": []interface{}{
+				map[string]interface{}{"iso_code": "ENG", "names": map[string]interface{}{"en": "England"}},
+			},
+			"city":     map[string]interface{}{"names": map[string]interface{}{"en": "London"}},
+			"postal":   map[string]interface{}{"code": "EC1A"},
+			"location": map[string]interface{}{"latitude": 51.5142, "longitude": -0.0931, "time_zone": "Europe/London", "accuracy_radius": uint16(10)},
+			"traits":   map[string]interface{}{"isp": "Example ISP", "user_type": "residential"},
+		},
+		"2001:db8::/32": {
+			"autonomous_system_number":       uint32(64496),
+			"autonomous_system_organization": "Example AS",
+		},
+	}
+}
+
+func TestMMDB_LookupIP(t *testing.T) {
+	db, err := newMMDB(buildTestMMDB(t, testMMDBNetworks()))
+	if err != nil {
+		t.Fatalf("Failed to open test MMDB: %v", err)
+	}
+
+	if db.DatabaseType() != "Test-City" {
+		t.Errorf("DatabaseType() = %q, want Test-City", db.DatabaseType())
+	}
+
+	record, err := db.LookupIP(net.ParseIP("81.2.69.160"))
+	if err != nil {
+		t.Fatalf("LookupIP failed: %v", err)
+	}
+	if record.Country.IsoCode != "GB" || record.Country.Names["en"] != "United Kingdom" {
+		t.Errorf("unexpected country: %+v", record.Country)
+	}
+	if record.Continent.Code != "EU" {
+		t.Errorf("unexpected continent: %+v", record.Continent)
+	}
+	if len(record.Subdivisions) != 1 || record.Subdivisions[0].IsoCode != "ENG" {
+		t.Errorf("unexpected subdivisions: %+v", record.Subdivisions)
+	}
+	if record.City.Names["en"] != "London" || record.Postal.Code != "EC1A" {
+		t.Errorf("unexpected city/postal: %+v %+v", record.City, record.Postal)
+	}
+	if record.Location.Latitude != 51.5142 || record.Location.TimeZone != "Europe/London" || record.Location.AccuracyRadius != 10 {
+		t.Errorf("unexpected location: %+v", record.Location)
+	}
+	if record.Traits.ISP != "Example ISP" || record.Traits.UserType != "residential" {
+		t.Errorf("unexpected traits: %+v", record.Traits)
+	}
+
+	record, err = db.LookupIP(net.ParseIP("2001:db8::1"))
+	if err != nil {
+		t.Fatalf("LookupIP failed: %v", err)
+	}
+	if record.Traits.AutonomousSystemNumber != 64496 || record.Traits.AutonomousSystemOrganization != "Example AS" {
+		t.Errorf("unexpected ASN traits: %+v", record.Traits)
+	}
+
+	record, err = db.LookupIP(net.ParseIP("8.8.8.8"))
+	if err != nil {
+		t.Fatalf("LookupIP failed for unknown address: %v", err)
+	}
+	if record.Country.IsoCode != "" {
+		t.Errorf("expected empty record for unknown address, got %+v", record)
+	}
+}
+
+func TestMMDB_DecodePointer(t *testing.T) {
+	// pointer (size 0, value 3) followed by the string it points to
+	buf := []byte{0x20, 0x03, 0x00}
+	buf = append(buf, encodeTestMMDBValue("hello")...)
+
+	d := mmdbDecoder{buf: buf}
+	value, next, err := d.decode(0, 0)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if value != "hello" {
+		t.Errorf("decode() = %v, want hello", value)
+	}
+	if next != 2 {
+		t.Errorf("next offset = %d, want 2", next)
+	}
+}
+
+func TestMMDB_InvalidFile(t *testing.T) {
+	if _, err := newMMDB([]byte("not a maxmind database")); err == nil {
+		t.Fatal("Expected error for file without metadata marker")
+	}
+}
+
+func TestOpenDatabase_SniffsMMDB(t *testing.T) {
+	// the extension is deliberately misleading, detection is by content
+	path := filepath.Join(t.TempDir(), "geo.bin")
+	if err := os.WriteFile(path, buildTestMMDB(t, testMMDBNetworks()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenDatabase(path, false)
+	if err != nil {
+		t.Fatalf("OpenDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if _, ok := db.(*MMDB); !ok {
+		t.Fatalf("OpenDatabase returned %T, want *MMDB", db)
+	}
+
+	record, err := db.Get_all("81.2.69.160")
+	if err != nil {
+		t.Fatalf("Get_all failed: %v", err)
+	}
+	if record.Country_short != "GB" || record.Region != "England" || record.City != "London" || record.Zipcode != "EC1A" {
+		t.Errorf("unexpected record: %+v", record)
+	}
+}
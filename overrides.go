@@ -0,0 +1,368 @@
+package traefik_plugin_ip2location
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// overridesReloadInterval is how often the overrides file is checked for
+// changes when reload_interval is not set.
+var overridesReloadInterval = 10 * time.Second
+
+// overrideStringFields maps override field names, which are the same as the
+// header options, to the record field they set.
+var overrideStringFields = map[string]func(r *IP2Locationrecord) *string{
+	"country_code":         func(r *IP2Locationrecord) *string { return &r.Country_short },
+	"country_name":         func(r *IP2Locationrecord) *string { return &r.Country_long },
+	"region":               func(r *IP2Locationrecord) *string { return &r.Region },
+	"region_code":          func(r *IP2Locationrecord) *string { return &r.Regioncode },
+	"city":                 func(r *IP2Locationrecord) *string { return &r.City },
+	"postal_code":          func(r *IP2Locationrecord) *string { return &r.Zipcode },
+	"timezone":             func(r *IP2Locationrecord) *string { return &r.Timezone },
+	"continent_code":       func(r *IP2Locationrecord) *string { return &r.Continentcode },
+	"continent_name":       func(r *IP2Locationrecord) *string { return &r.Continentname },
+	"isp":                  func(r *IP2Locationrecord) *string { return &r.Isp },
+	"asn":                  func(r *IP2Locationrecord) *string { return &r.Asn },
+	"asn_organization":     func(r *IP2Locationrecord) *string { return &r.As },
+	"domain":               func(r *IP2Locationrecord) *string { return &r.Domain },
+	"net_speed":            func(r *IP2Locationrecord) *string { return &r.Netspeed },
+	"idd_code":             func(r *IP2Locationrecord) *string { return &r.Iddcode },
+	"area_code":            func(r *IP2Locationrecord) *string { return &r.Areacode },
+	"weather_station_code": func(r *IP2Locationrecord) *string { return &r.Weatherstationcode },
+	"weather_station_name": func(r *IP2Locationrecord) *string { return &r.Weatherstationname },
+	"mcc":                  func(r *IP2Locationrecord) *string { return &r.Mcc },
+	"mnc":                  func(r *IP2Locationrecord) *string { return &r.Mnc },
+	"mobile_brand":         func(r *IP2Locationrecord) *string { return &r.Mobilebrand },
+	"usage_type":           func(r *IP2Locationrecord) *string { return &r.Usagetype },
+	"address_type":         func(r *IP2Locationrecord) *string { return &r.Addresstype },
+	"category":             func(r *IP2Locationrecord) *string { return &r.Category },
+	"district":             func(r *IP2Locationrecord) *string { return &r.District },
+}
+
+// overrideFloatFields maps the numeric override fields to the record field they set.
+var overrideFloatFields = map[string]func(r *IP2Locationrecord) *float32{
+	"latitude":  func(r *IP2Locationrecord) *float32 { return &r.Latitude },
+	"longitude": func(r *IP2Locationrecord) *float32 { return &r.Longitude },
+	"elevation": func(r *IP2Locationrecord) *float32 { return &r.Elevation },
+}
+
+// override holds the field values configured for one CIDR.
+type override struct {
+	// fill only sets fields the database left empty instead of replacing them
+	fill    bool
+	setters []func(r *IP2Locationrecord, fill bool)
+	// resetContinent re-derives the continent from an overridden country
+	resetContinent bool
+}
+
+// apply writes the override values into record.
+func (o *override) apply(record *IP2Locationrecord) {
+	if o.resetContinent && !o.fill {
+		record.Continentcode, record.Continentname = "", ""
+	}
+	for _, set := range o.setters {
+		set(record, o.fill)
+	}
+}
+
+// newOverride builds an override from field name and value pairs. The
+// "mode" field selects "override" (the default) or "fill".
+func newOverride(values map[string]string) (*override, error) {
+	o := &override{}
+	country, continent := false, false
+	for k, v := range values {
+		key, value := strings.ToLower(strings.TrimSpace(k)), strings.TrimSpace(v)
+		if value == "" {
+			continue
+		}
+		country = country || key == "country_code"
+		continent = continent || key == "continent_code"
+
+		if key == "mode" {
+			switch value {
+			case "override":
+			case "fill":
+				o.fill = true
+			default:
+				return nil, fmt.Errorf("invalid mode %q, must be override or fill", value)
+			}
+			continue
+		}
+
+		if field, ok := overrideStringFields[key]; ok {
+			o.setters = append(o.setters, func(r *IP2Locationrecord, fill bool) {
+				if p := field(r); !fill || *p == "" || *p == "-" {
+					*p = value
+				}
+			})
+			continue
+		}
+
+		if field, ok := overrideFloatFields[key]; ok {
+			f, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", key, value)
+			}
+			o.setters = append(o.setters, func(r *IP2Locationrecord, fill bool) {
+				if p := field(r); !fill || *p == 0 {
+					*p = float32(f)
+				}
+			})
+			continue
+		}
+
+		if key == "accuracy_radius" {
+			n, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", key, value)
+			}
+			o.setters = append(o.setters, func(r *IP2Locationrecord, fill bool) {
+				if !fill || r.Accuracyradius == 0 {
+					r.Accuracyradius = uint16(n)
+				}
+			})
+			continue
+		}
+
+		return nil, fmt.Errorf("unknown field %q", key)
+	}
+
+	o.resetContinent = country && !continent
+	return o, nil
+}
+
+// prefixNode is a node of a binary trie over the bits of IPv6 addresses;
+// IPv4 prefixes are stored under ::ffff:0:0/96.
+type prefixNode struct {
+	children [2]*prefixNode
+	value    *override
+}
+
+// overrideTable is a loaded overrides file.
+type overrideTable struct {
+	root prefixNode
+}
+
+func (t *overrideTable) insert(n *net.IPNet, o *override) {
+	ip := n.IP.To16()
+	ones, bits := n.Mask.Size()
+	if bits == 32 {
+		ones += 96
+	}
+	node := &t.root
+	for i := 0; i < ones; i++ {
+		bit := ip[i/8] >> (7 - uint(i%8)) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &prefixNode{}
+		}
+		node = node.children[bit]
+	}
+	node.value = o
+}
+
+// lookup returns the override of the longest prefix containing ip, or nil.
+func (t *overrideTable) lookup(ip net.IP) *override {
+	ip = ip.To16()
+	if ip == nil {
+		return nil
+	}
+	node := &t.root
+	match := node.value
+	for i := 0; i < 128 && node != nil; i++ {
+		node = node.children[ip[i/8]>>(7-uint(i%8))&1]
+		if node != nil && node.value != nil {
+			match = node.value
+		}
+	}
+	return match
+}
+
+// Close implements closer; the table holds no resources.
+func (t *overrideTable) Close() {}
+
+// loadOverrides reads a CSV (.csv) or YAML (.yaml, .yml) overrides file.
+func loadOverrides(path string) (*overrideTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &overrideTable{}
+	add := func(cidr string, values map[string]string) error {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return err
+		}
+		o, err := newOverride(values)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cidr, err)
+		}
+		t.insert(n, o)
+		return nil
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		err = parseOverridesCSV(f, add)
+	case ".yaml", ".yml":
+		err = parseOverridesYAML(f, add)
+	default:
+		err = fmt.Errorf("unsupported overrides file type, use .csv, .yaml or .yml")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// parseOverridesCSV reads a CSV file whose header row names the fields, the
+// first column being the CIDR. Empty cells leave the field alone.
+func parseOverridesCSV(r io.Reader, add func(cidr string, values map[string]string) error) error {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	if len(header) == 0 || strings.ToLower(strings.TrimSpace(header[0])) != "cidr" {
+		return fmt.Errorf("the first column must be cidr")
+	}
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		values := make(map[string]string, len(header)-1)
+		for i := 1; i < len(row); i++ {
+			values[header[i]] = row[i]
+		}
+		if err := add(row[0], values); err != nil {
+			line, _ := cr.FieldPos(0)
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+// parseOverridesYAML reads the YAML subset used for overrides files: a map
+// of CIDRs to maps of field values.
+//
+//	"203.0.113.0/24":
+//	  country_code: DE
+//	  city: Berlin
+func parseOverridesYAML(r io.Reader, add func(cidr string, values map[string]string) error) error {
+	scanner := bufio.NewScanner(r)
+	var cidr string
+	var values map[string]string
+	cidrLine := 0
+
+	flush := func() error {
+		if cidr == "" {
+			return nil
+		}
+		if err := add(cidr, values); err != nil {
+			return fmt.Errorf("line %d: %w", cidrLine, err)
+		}
+		return nil
+	}
+
+	for line := 1; scanner.Scan(); line++ {
+		text := stripYAMLComment(scanner.Text())
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		// unindented lines start a CIDR; IPv6 CIDRs contain colons themselves
+		if text[0] != ' ' && text[0] != '\t' {
+			key := strings.TrimSpace(text)
+			if !strings.HasSuffix(key, ":") {
+				return fmt.Errorf("line %d: expected a CIDR followed by a colon", line)
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			cidr = unquoteYAML(strings.TrimSuffix(key, ":"))
+			values = map[string]string{}
+			cidrLine = line
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimSpace(text), ":")
+		if cidr == "" || !ok {
+			return fmt.Errorf("line %d: expected an indented field: value pair", line)
+		}
+		values[strings.TrimSpace(key)] = unquoteYAML(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// stripYAMLComment removes a # comment that is not inside quotes.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// unquoteYAML trims s and removes matching single or double quotes.
+func unquoteYAML(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// overrideLookup is implemented by *overrideTable and its reloadable wrapper.
+type overrideLookup interface {
+	lookup(ip net.IP) *override
+	Close()
+}
+
+// reloadableOverrides is an overrideLookup backed by a reloader.
+type reloadableOverrides struct {
+	*reloader
+}
+
+func newReloadableOverrides(name, path string, t *overrideTable) reloadableOverrides {
+	return reloadableOverrides{newReloader(name, path, t, func(path string) (closer, error) {
+		t, err := loadOverrides(path)
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	})}
+}
+
+func (r reloadableOverrides) lookup(ip net.IP) *override {
+	h := r.acquire()
+	defer h.release()
+	return h.db.(*overrideTable).lookup(ip)
+}
@@ -0,0 +1,220 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeOverrides(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write overrides file: %v", err)
+	}
+	return path
+}
+
+func TestLoadOverrides_CSV(t *testing.T) {
+	path := writeOverrides(t, "overrides.csv", `cidr,country_code,city,latitude,mode
+# office network
+203.0.113.0/24,DE,Berlin,52.52,
+203.0.113.128/25,,Hamburg,,fill
+2001:db8::/32,FR,,,
+`)
+	table, err := loadOverrides(path)
+	if err != nil {
+		t.Fatalf("loadOverrides failed: %v", err)
+	}
+
+	record := IP2Locationrecord{Country_short: "US", City: "-"}
+	table.lookup(net.ParseIP("203.0.113.1")).apply(&record)
+	if record.Country_short != "DE" || record.City != "Berlin" || record.Latitude != 52.52 {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	// the longer prefix wins and only fills empty fields
+	record = IP2Locationrecord{City: "Munich"}
+	table.lookup(net.ParseIP("203.0.113.200")).apply(&record)
+	if record.City != "Munich" {
+		t.Errorf("City = %q, want the database value kept in fill mode", record.City)
+	}
+	record = IP2Locationrecord{City: "-"}
+	table.lookup(net.ParseIP("203.0.113.200")).apply(&record)
+	if record.City != "Hamburg" {
+		t.Errorf("City = %q, want Hamburg", record.City)
+	}
+
+	if o := table.lookup(net.ParseIP("2001:db8::1")); o == nil {
+		t.Error("expected a match for 2001:db8::1")
+	}
+	for _, ip := range []string{"203.0.114.1", "::ffff:203.0.112.255", "2001:db9::1"} {
+		if o := table.lookup(net.ParseIP(ip)); o != nil {
+			t.Errorf("unexpected match for %s", ip)
+		}
+	}
+}
+
+func TestLoadOverrides_YAML(t *testing.T) {
+	path := writeOverrides(t, "overrides.yaml", `# internal ranges
+"10.0.0.0/8":
+  country_code: GB   # London office
+  city: 'London'
+2001:db8::/48:
+  country_code: "NL"
+  accuracy_radius: 5
+`)
+	table, err := loadOverrides(path)
+	if err != nil {
+		t.Fatalf("loadOverrides failed: %v", err)
+	}
+
+	record := IP2Locationrecord{Continentcode: "NA", Continentname: "North America"}
+	table.lookup(net.ParseIP("10.1.2.3")).apply(&record)
+	if record.Country_short != "GB" || record.City != "London" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if record.Continentcode != "" {
+		t.Errorf("Continentcode = %q, want it cleared for re-derivation", record.Continentcode)
+	}
+
+	record = IP2Locationrecord{}
+	table.lookup(net.ParseIP("2001:db8:0:1::1")).apply(&record)
+	if record.Country_short != "NL" || record.Accuracyradius != 5 {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
+
+func TestLoadOverrides_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"bad-cidr.csv":      "cidr,country_code\n10.0.0.0/33,DE\n",
+		"no-cidr.csv":       "network,country_code\n10.0.0.0/8,DE\n",
+		"unknown-field.csv": "cidr,planet\n10.0.0.0/8,Mars\n",
+		"bad-float.csv":     "cidr,latitude\n10.0.0.0/8,north\n",
+		"bad-mode.yaml":     "10.0.0.0/8:\n  mode: replace\n",
+		"no-cidr.yaml":      "  country_code: DE\n",
+		"overrides.json":    "{}",
+	}
+	for name, content := range tests {
+		if _, err := loadOverrides(writeOverrides(t, name, content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestGeoIP_Overrides(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.70.0"},
+	})
+	overridesPath := writeOverrides(t, "overrides.csv", "cidr,country_code\n81.2.69.160/28,FR\n10.0.0.0/8,DE\n")
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:          dbPath,
+		OverridesFilename: overridesPath,
+		CountryCode:       "X-Country-Code",
+		ContinentCode:     "X-Continent-Code",
+		CacheSize:         10,
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remote    string
+		country   string
+		continent string
+	}{
+		{"81.2.69.1:1234", "GB", "EU"},
+		{"81.2.69.161:1234", "FR", "EU"},
+		{"81.2.69.2:1234", "GB", "EU"},
+		{"10.1.2.3:1234", "DE", "EU"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.RemoteAddr = tt.remote
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got := req.Header.Get("X-Country-Code"); got != tt.country {
+			t.Errorf("%s: X-Country-Code = %q, want %q", tt.remote, got, tt.country)
+		}
+		if got := req.Header.Get("X-Continent-Code"); got != tt.continent {
+			t.Errorf("%s: X-Continent-Code = %q, want %q", tt.remote, got, tt.continent)
+		}
+	}
+
+	_, err = New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:          dbPath,
+		OverridesFilename: writeOverrides(t, "bad.csv", "cidr,country_code\nnope,DE\n"),
+	}, "test")
+	if err == nil {
+		t.Error("Expected error for invalid overrides file")
+	}
+}
+
+// TestGeoIP_OverridesReload tests that the overrides file is reloaded on
+// change without reload_interval.
+func TestGeoIP_OverridesReload(t *testing.T) {
+	interval := overridesReloadInterval
+	overridesReloadInterval = 10 * time.Millisecond
+	defer func() { overridesReloadInterval = interval }()
+
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.70.0"},
+	})
+	overridesPath := writeOverrides(t, "overrides.csv", "cidr,country_code\n10.0.0.0/8,DE\n")
+	newPath := writeOverrides(t, "new.csv", "cidr,country_code\n10.0.0.0/8,AT\n81.2.69.0/24,FR\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := New(ctx, &httpHandlerMock{}, &Config{
+		Filename:          dbPath,
+		OverridesFilename: overridesPath,
+		CountryCode:       "X-Country-Code",
+		CacheSize:         10,
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	country := func(remote string) string {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.RemoteAddr = remote
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return req.Header.Get("X-Country-Code")
+	}
+
+	if got := country("10.1.2.3:1234"); got != "DE" {
+		t.Fatalf("10.1.2.3 before reload = %q, want DE", got)
+	}
+	if got := country("81.2.69.1:1234"); got != "GB" {
+		t.Fatalf("81.2.69.1 before reload = %q, want GB", got)
+	}
+
+	if err := os.Rename(newPath, overridesPath); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(overridesPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for country("10.1.2.3:1234") != "AT" {
+		if time.Now().After(deadline) {
+			t.Fatal("overrides file was not reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// the cached database record is replaced by the new override
+	if got := country("81.2.69.1:1234"); got != "FR" {
+		t.Errorf("81.2.69.1 after reload = %q, want FR", got)
+	}
+}
@@ -0,0 +1,113 @@
+package traefik_plugin_ip2location
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// trustedProxyPresets holds the ranges behind the named trusted_proxies
+// entries. They are kept in Go source rather than go:embed files because
+// Yaegi cannot load embedded files.
+var trustedProxyPresets = map[string]string{
+	// RFC 1918, loopback and unique local addresses
+	"private": `
+10.0.0.0/8
+172.16.0.0/12
+192.168.0.0/16
+127.0.0.0/8
+::1/128
+fc00::/7
+`,
+	// https://www.cloudflare.com/ips-v4 and https://www.cloudflare.com/ips-v6
+	"cloudflare": `
+173.245.48.0/20
+103.21.244.0/22
+103.22.200.0/22
+103.31.4.0/22
+141.101.64.0/18
+108.162.192.0/18
+190.93.240.0/20
+188.114.96.0/20
+197.234.240.0/22
+198.41.128.0/17
+162.158.0.0/15
+104.16.0.0/13
+104.24.0.0/14
+172.64.0.0/13
+131.0.72.0/22
+2400:cb00::/32
+2606:4700::/32
+2803:f800::/32
+2405:b500::/32
+2405:8100::/32
+2a06:98c0::/29
+2c0f:f248::/32
+`,
+	// https://api.fastly.com/public-ip-list
+	"fastly": `
+23.235.32.0/20
+43.249.72.0/22
+103.244.50.0/24
+103.245.222.0/23
+103.245.224.0/24
+104.156.80.0/20
+140.248.64.0/18
+140.248.128.0/17
+146.75.0.0/17
+151.101.0.0/16
+157.52.64.0/18
+167.82.0.0/17
+167.82.128.0/20
+167.82.160.0/20
+167.82.224.0/20
+172.111.64.0/18
+185.31.16.0/22
+199.27.72.0/21
+199.232.0.0/16
+2a04:4e40::/32
+2a04:4e42::/32
+`,
+}
+
+// parseTrustedProxies parses trusted_proxies entries, each a CIDR range, a
+// single IP or the name of a preset.
+func parseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	return parseIPRanges("trusted_proxies", entries)
+}
+
+// parseIPRanges parses the entries of the named range list option, each a
+// CIDR range, a single IP or the name of a preset.
+func parseIPRanges(option string, entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if preset, ok := trustedProxyPresets[strings.ToLower(entry)]; ok {
+			for _, cidr := range strings.Fields(preset) {
+				_, ipNet, err := net.ParseCIDR(cidr)
+				if err != nil {
+					return nil, fmt.Errorf("invalid range %q in %s preset %q: %w", cidr, option, entry, err)
+				}
+				nets = append(nets, ipNet)
+			}
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			// Try parsing as single IP
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid %s entry %q: not a CIDR range, IP or preset", option, entry)
+			}
+			// Create a /32 or /128 network for a single IP
+			if v4 := ip.To4(); v4 != nil {
+				ipNet = &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}
+			} else {
+				ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+			}
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
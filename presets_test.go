@@ -0,0 +1,93 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets, err := parseTrustedProxies([]string{"private", "Cloudflare", "fastly", "203.0.113.0/24", "198.51.100.7", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("parseTrustedProxies failed: %v", err)
+	}
+
+	contains := func(ip string) bool {
+		for _, n := range nets {
+			if n.Contains(net.ParseIP(ip)) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, ip := range []string{"10.1.2.3", "192.168.0.1", "127.0.0.1", "::1", "fd00::1", "104.16.0.1", "2606:4700::1", "151.101.1.1", "203.0.113.9", "198.51.100.7", "2001:db8::1"} {
+		if !contains(ip) {
+			t.Errorf("expected %s to be trusted", ip)
+		}
+	}
+	for _, ip := range []string{"8.8.8.8", "198.51.100.8", "2001:db8::2"} {
+		if contains(ip) {
+			t.Errorf("expected %s not to be trusted", ip)
+		}
+	}
+
+	if _, err := parseTrustedProxies([]string{"10.0.0.0/8", "10.0.0.0/33"}); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+	if _, err := parseTrustedProxies([]string{"akamai"}); err == nil {
+		t.Error("expected error for unknown preset")
+	}
+}
+
+func TestGeoIP_StrictTrustedProxies(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.70.0"},
+	})
+
+	config := CreateConfig()
+	config.Filename = dbPath
+	config.ClientIp = "X-Client-Addr"
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "81.2.69.160")
+	req.Header.Set("X-Real-IP", "81.2.69.160")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := req.Header.Get("X-Client-Addr"); got != "192.0.2.1" {
+		t.Errorf("client IP = %q, want the peer address with no trusted proxies", got)
+	}
+
+	config.TrustedProxies = []string{"private"}
+	handler, err = New(context.Background(), &httpHandlerMock{}, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "81.2.69.160")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := req.Header.Get("X-Client-Addr"); got != "81.2.69.160" {
+		t.Errorf("client IP = %q, want 81.2.69.160 from a private peer", got)
+	}
+}
+
+func TestGeoIP_InvalidTrustedProxy(t *testing.T) {
+	_, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:       "IP2LOCATION-LITE-DB1.BIN",
+		TrustedProxies: []string{"10.0.0.0/8", "not-a-range"},
+	}, "test")
+	if err == nil {
+		t.Fatal("Expected error for invalid trusted_proxies entry")
+	}
+}
@@ -0,0 +1,229 @@
+package traefik_plugin_ip2location
+
+import "fmt"
+
+// The IP2Proxyrecord struct stores all of the available
+// proxy info found in the IP2Proxy database.
+type IP2Proxyrecord struct {
+	Country_short string
+	Country_long  string
+	Region        string
+	City          string
+	Isp           string
+	Proxytype     string
+	Domain        string
+	Usagetype     string
+	Asn           string
+	As            string
+	Lastseen      string
+	Threat        string
+	Provider      string
+	Fraudscore    string
+	// Isproxy is -1 when the lookup failed, 0 for no proxy, 1 for a proxy
+	// and 2 for a data center or search engine range.
+	Isproxy int8
+}
+
+// ProxyDB reads IP2Proxy PX BIN files. The header and row layout are the same
+// as IP2Location BIN files, only the columns differ.
+type ProxyDB struct {
+	reader *DB
+
+	country_position_offset    uint32
+	region_position_offset     uint32
+	city_position_offset       uint32
+	isp_position_offset        uint32
+	proxytype_position_offset  uint32
+	domain_position_offset     uint32
+	usagetype_position_offset  uint32
+	asn_position_offset        uint32
+	as_position_offset         uint32
+	lastseen_position_offset   uint32
+	threat_position_offset     uint32
+	provider_position_offset   uint32
+	fraudscore_position_offset uint32
+
+	country_enabled    bool
+	region_enabled     bool
+	city_enabled       bool
+	isp_enabled        bool
+	proxytype_enabled  bool
+	domain_enabled     bool
+	usagetype_enabled  bool
+	asn_enabled        bool
+	as_enabled         bool
+	lastseen_enabled   bool
+	threat_enabled     bool
+	provider_enabled   bool
+	fraudscore_enabled bool
+}
+
+var px_country_position = [13]uint8{0, 2, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3}
+var px_region_position = [13]uint8{0, 0, 0, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4}
+var px_city_position = [13]uint8{0, 0, 0, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5}
+var px_isp_position = [13]uint8{0, 0, 0, 0, 6, 6, 6, 6, 6, 6, 6, 6, 6}
+var px_proxytype_position = [13]uint8{0, 0, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2}
+var px_domain_position = [13]uint8{0, 0, 0, 0, 0, 7, 7, 7, 7, 7, 7, 7, 7}
+var px_usagetype_position = [13]uint8{0, 0, 0, 0, 0, 0, 8, 8, 8, 8, 8, 8, 8}
+var px_asn_position = [13]uint8{0, 0, 0, 0, 0, 0, 0, 9, 9, 9, 9, 9, 9}
+var px_as_position = [13]uint8{0, 0, 0, 0, 0, 0, 0, 10, 10, 10, 10, 10, 10}
+var px_lastseen_position = [13]uint8{0, 0, 0, 0, 0, 0, 0, 0, 11, 11, 11, 11, 11}
+var px_threat_position = [13]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 12, 12, 12, 12}
+var px_provider_position = [13]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 13, 13}
+var px_fraudscore_position = [13]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 14}
+
+// OpenProxyDB takes the path to the IP2Proxy BIN database file. It will read all the metadata required to
+// be able to extract the embedded proxy data, and return the underlining ProxyDB object.
+func OpenProxyDB(dbpath string) (*ProxyDB, error) {
+	return openProxyDB(dbpath, false)
+}
+
+// OpenProxyDBInMemory is like OpenProxyDB but loads the whole BIN file into memory.
+func OpenProxyDBInMemory(dbpath string) (*ProxyDB, error) {
+	return openProxyDB(dbpath, true)
+}
+
+func openProxyDB(dbpath string, inMemory bool) (*ProxyDB, error) {
+	var db = &DB{}
+
+	if err := db.open(dbpath, inMemory); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if db.meta.productcode == ip2location_productcode {
+		db.Close()
+		return nil, fmt.Errorf("this is an IP2Location BIN file, use OpenDB instead")
+	}
+
+	dbt := db.meta.databasetype
+	if int(dbt) >= len(px_country_position) {
+		db.Close()
+		return nil, fmt.Errorf("unsupported IP2Proxy database type %d", dbt)
+	}
+
+	p := &ProxyDB{reader: db}
+
+	if px_country_position[dbt] != 0 {
+		p.country_position_offset = uint32(px_country_position[dbt]-2) << 2
+		p.country_enabled = true
+	}
+	if px_region_position[dbt] != 0 {
+		p.region_position_offset = uint32(px_region_position[dbt]-2) << 2
+		p.region_enabled = true
+	}
+	if px_city_position[dbt] != 0 {
+		p.city_position_offset = uint32(px_city_position[dbt]-2) << 2
+		p.city_enabled = true
+	}
+	if px_isp_position[dbt] != 0 {
+		p.isp_position_offset = uint32(px_isp_position[dbt]-2) << 2
+		p.isp_enabled = true
+	}
+	if px_proxytype_position[dbt] != 0 {
+		p.proxytype_position_offset = uint32(px_proxytype_position[dbt]-2) << 2
+		p.proxytype_enabled = true
+	}
+	if px_domain_position[dbt] != 0 {
+		p.domain_position_offset = uint32(px_domain_position[dbt]-2) << 2
+		p.domain_enabled = true
+	}
+	if px_usagetype_position[dbt] != 0 {
+		p.usagetype_position_offset = uint32(px_usagetype_position[dbt]-2) << 2
+		p.usagetype_enabled = true
+	}
+	if px_asn_position[dbt] != 0 {
+		p.asn_position_offset = uint32(px_asn_position[dbt]-2) << 2
+		p.asn_enabled = true
+	}
+	if px_as_position[dbt] != 0 {
+		p.as_position_offset = uint32(px_as_position[dbt]-2) << 2
+		p.as_enabled = true
+	}
+	if px_lastseen_position[dbt] != 0 {
+		p.lastseen_position_offset = uint32(px_lastseen_position[dbt]-2) << 2
+		p.lastseen_enabled = true
+	}
+	if px_threat_position[dbt] != 0 {
+		p.threat_position_offset = uint32(px_threat_position[dbt]-2) << 2
+		p.threat_enabled = true
+	}
+	if px_provider_position[dbt] != 0 {
+		p.provider_position_offset = uint32(px_provider_position[dbt]-2) << 2
+		p.provider_enabled = true
+	}
+	if px_fraudscore_position[dbt] != 0 {
+		p.fraudscore_position_offset = uint32(px_fraudscore_position[dbt]-2) << 2
+		p.fraudscore_enabled = true
+	}
+
+	db.metaok = true
+
+	return p, nil
+}
+
+// Get_all will return all proxy fields based on the queried IP address.
+func (p *ProxyDB) Get_all(ipaddress string) (IP2Proxyrecord, error) {
+	x := IP2Proxyrecord{Isproxy: -1}
+	d := p.reader
+
+	if !d.metaok {
+		return x, fmt.Errorf(missing_file)
+	}
+
+	row, _, err := d.findrow(ipaddress)
+	if err != nil || row == nil {
+		return x, err
+	}
+
+	if p.country_enabled {
+		pos := d.readuint32_row(row, p.country_position_offset)
+		if x.Country_short, err = d.readstr(pos); err != nil {
+			return x, err
+		}
+		if x.Country_long, err = d.readstr(pos + 3); err != nil {
+			return x, err
+		}
+	}
+
+	fields := []struct {
+		enabled bool
+		offset  uint32
+		value   *string
+	}{
+		{p.region_enabled, p.region_position_offset, &x.Region},
+		{p.city_enabled, p.city_position_offset, &x.City},
+		{p.isp_enabled, p.isp_position_offset, &x.Isp},
+		{p.proxytype_enabled, p.proxytype_position_offset, &x.Proxytype},
+		{p.domain_enabled, p.domain_position_offset, &x.Domain},
+		{p.usagetype_enabled, p.usagetype_position_offset, &x.Usagetype},
+		{p.asn_enabled, p.asn_position_offset, &x.Asn},
+		{p.as_enabled, p.as_position_offset, &x.As},
+		{p.lastseen_enabled, p.lastseen_position_offset, &x.Lastseen},
+		{p.threat_enabled, p.threat_position_offset, &x.Threat},
+		{p.provider_enabled, p.provider_position_offset, &x.Provider},
+		{p.fraudscore_enabled, p.fraudscore_position_offset, &x.Fraudscore},
+	}
+	for _, f := range fields {
+		if !f.enabled {
+			continue
+		}
+		if *f.value, err = d.readstr(d.readuint32_row(row, f.offset)); err != nil {
+			return x, err
+		}
+	}
+
+	switch {
+	case x.Country_short == "-" || x.Proxytype == "-":
+		x.Isproxy = 0
+	case x.Proxytype == "DCH" || x.Proxytype == "SES":
+		x.Isproxy = 2
+	default:
+		x.Isproxy = 1
+	}
+
+	return x, nil
+}
+
+func (p *ProxyDB) Close() {
+	p.reader.Close()
+}
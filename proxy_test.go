@@ -0,0 +1,82 @@
+package traefik_plugin_ip2location
+
+import "testing"
+
+// buildTestPX writes an IPv4-only IP2Proxy BIN file of the given database type.
+func buildTestPX(t *testing.T, dbtype uint8, rows []testBINRow) string {
+	t.Helper()
+	return buildTestBINFile(t, ip2proxy_productcode, dbtype, []testBINColumn{
+		{"country", px_country_position[:]},
+		{"region", px_region_position[:]},
+		{"city", px_city_position[:]},
+		{"isp", px_isp_position[:]},
+		{"proxytype", px_proxytype_position[:]},
+		{"domain", px_domain_position[:]},
+		{"usagetype", px_usagetype_position[:]},
+		{"asn", px_asn_position[:]},
+		{"as", px_as_position[:]},
+		{"lastseen", px_lastseen_position[:]},
+		{"threat", px_threat_position[:]},
+		{"provider", px_provider_position[:]},
+		{"fraudscore", px_fraudscore_position[:]},
+	}, rows)
+}
+
+func TestProxyDB_GetAll(t *testing.T) {
+	path := buildTestPX(t, 11, []testBINRow{
+		{from: "0.0.0.0", fields: map[string]string{"country_short": "-", "proxytype": "-"}},
+		{from: "1.2.3.0", fields: map[string]string{
+			"country_short": "NL",
+			"country_long":  "Netherlands",
+			"proxytype":     "VPN",
+			"lastseen":      "3",
+			"threat":        "SPAM",
+			"provider":      "ExampleVPN",
+		}},
+		{from: "1.2.4.0", fields: map[string]string{"country_short": "US", "proxytype": "DCH"}},
+		{from: "1.2.5.0", fields: map[string]string{"country_short": "-", "proxytype": "-"}},
+	})
+
+	db, err := OpenProxyDB(path)
+	if err != nil {
+		t.Fatalf("OpenProxyDB failed: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		ip        string
+		isproxy   int8
+		proxytype string
+		provider  string
+	}{
+		{"1.2.3.4", 1, "VPN", "ExampleVPN"},
+		{"1.2.4.4", 2, "DCH", ""},
+		{"1.2.5.4", 0, "-", ""},
+	}
+	for _, tt := range tests {
+		record, err := db.Get_all(tt.ip)
+		if err != nil {
+			t.Fatalf("Get_all(%s) failed: %v", tt.ip, err)
+		}
+		if record.Isproxy != tt.isproxy || record.Proxytype != tt.proxytype || record.Provider != tt.provider {
+			t.Errorf("Get_all(%s) = %d %q %q, want %d %q %q", tt.ip, record.Isproxy, record.Proxytype, record.Provider, tt.isproxy, tt.proxytype, tt.provider)
+		}
+	}
+
+	record, _ := db.Get_all("1.2.3.4")
+	if record.Country_long != "Netherlands" || record.Threat != "SPAM" || record.Lastseen != "3" {
+		t.Errorf("unexpected record: %+v", record)
+	}
+}
+
+func TestProxyDB_ProductCodeMismatch(t *testing.T) {
+	binPath := buildTestBIN(t, 1, []testBINRow{{from: "0.0.0.0", fields: map[string]string{"country_short": "US"}}})
+	if _, err := OpenProxyDB(binPath); err == nil {
+		t.Error("Expected OpenProxyDB to reject an IP2Location BIN file")
+	}
+
+	pxPath := buildTestPX(t, 1, []testBINRow{{from: "0.0.0.0", fields: map[string]string{"country_short": "US"}}})
+	if _, err := OpenDB(pxPath); err == nil {
+		t.Error("Expected OpenDB to reject an IP2Proxy BIN file")
+	}
+}
@@ -0,0 +1,248 @@
+package traefik_plugin_ip2location
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRateLimitMaxBuckets bounds the bucket map when rate_limit_max_buckets is not set.
+const defaultRateLimitMaxBuckets = 10000
+
+// rateLimitKinds lists the record values rate limits can be keyed on.
+var rateLimitKinds = []string{"country", "asn", "usage_type"}
+
+// rateRule is one rate_limits entry. Every value it matches, e.g. each
+// country, gets its own bucket.
+type rateRule struct {
+	key   string
+	rate  float64 // tokens per second
+	burst float64
+}
+
+// tokenBucket holds the tokens left for one rule and value.
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter limits requests per country, ASN or usage type with token
+// buckets. The buckets are kept in a bounded LRU list.
+type rateLimiter struct {
+	// specific maps kind and value to the rule listing it, wildcard maps
+	// kind to the "*" rule
+	specific   map[string]map[string]*rateRule
+	wildcard   map[string]*rateRule
+	maxBuckets int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List // of *tokenBucket, most recently used first
+	buckets map[string]*list.Element
+}
+
+// newRateLimiter builds the rate limiter from the configuration. It returns
+// nil when no rate limit is configured. Keys are a kind followed by comma
+// separated values or "*", e.g. "country:RU,CN" or "asn:*"; values are a
+// request count per period, e.g. "10/1m" or "5/s".
+func newRateLimiter(config *Config) (*rateLimiter, error) {
+	if len(config.RateLimits) == 0 {
+		return nil, nil
+	}
+
+	l := &rateLimiter{
+		specific:   map[string]map[string]*rateRule{},
+		wildcard:   map[string]*rateRule{},
+		maxBuckets: config.RateLimitMaxBuckets,
+		now:        time.Now,
+		lru:        list.New(),
+		buckets:    map[string]*list.Element{},
+	}
+	if l.maxBuckets < 0 {
+		return nil, fmt.Errorf("invalid rate_limit_max_buckets %d", l.maxBuckets)
+	}
+	if l.maxBuckets == 0 {
+		l.maxBuckets = defaultRateLimitMaxBuckets
+	}
+
+	for key, limit := range config.RateLimits {
+		kind, valueList, ok := strings.Cut(strings.TrimSpace(key), ":")
+		kind = strings.ToLower(kind)
+		if !ok || !validRateLimitKind(kind) {
+			return nil, fmt.Errorf("invalid rate_limits key %q, must be country, asn or usage_type followed by a colon and values", key)
+		}
+
+		rule := &rateRule{key: key}
+		count, period, err := parseRateLimit(limit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %q for %q: %w", limit, key, err)
+		}
+		rule.rate, rule.burst = float64(count)/period.Seconds(), float64(count)
+
+		values := strings.FieldsFunc(valueList, func(c rune) bool { return c == ',' || c == ' ' })
+		if len(values) == 0 {
+			return nil, fmt.Errorf("rate_limits key %q lists no values", key)
+		}
+		for _, value := range values {
+			if value == "*" {
+				if l.wildcard[kind] != nil {
+					return nil, fmt.Errorf("rate_limits lists %s:* more than once", kind)
+				}
+				l.wildcard[kind] = rule
+				continue
+			}
+			value = normalizeRateLimitValue(kind, value)
+			if l.specific[kind] == nil {
+				l.specific[kind] = map[string]*rateRule{}
+			}
+			if l.specific[kind][value] != nil {
+				return nil, fmt.Errorf("rate_limits lists %s:%s more than once", kind, value)
+			}
+			l.specific[kind][value] = rule
+		}
+	}
+	return l, nil
+}
+
+func validRateLimitKind(kind string) bool {
+	for _, k := range rateLimitKinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRateLimitValue makes configured and looked up values comparable:
+// codes are upper case and ASNs are numbers without the "AS" prefix.
+func normalizeRateLimitValue(kind, value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if kind == "asn" {
+		value = strings.TrimPrefix(value, "AS")
+	}
+	return value
+}
+
+// parseRateLimit parses "<count>/<period>", where the period is a Go duration
+// or a bare unit such as "s", "m" or "h".
+func parseRateLimit(s string) (int, time.Duration, error) {
+	countStr, periodStr, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("must be <count>/<period>")
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(countStr))
+	if err != nil || count <= 0 {
+		return 0, 0, fmt.Errorf("invalid count %q", countStr)
+	}
+	periodStr = strings.TrimSpace(periodStr)
+	if periodStr != "" && (periodStr[0] < '0' || periodStr[0] > '9') {
+		periodStr = "1" + periodStr
+	}
+	period, err := time.ParseDuration(periodStr)
+	if err != nil || period <= 0 {
+		return 0, 0, fmt.Errorf("invalid period %q", periodStr)
+	}
+	return count, period, nil
+}
+
+// recordValues returns the values of record for kind, skipping unknown ones.
+// Combined usage types such as "ISP/MOB" yield each code.
+func recordValues(kind string, record IP2Locationrecord) []string {
+	var raw []string
+	switch kind {
+	case "country":
+		raw = []string{record.Country_short}
+	case "asn":
+		raw = []string{record.Asn}
+	case "usage_type":
+		raw = strings.Split(record.Usagetype, "/")
+	}
+	values := raw[:0]
+	for _, v := range raw {
+		if v = normalizeRateLimitValue(kind, v); v != "" && v != "-" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// allow takes a token from every bucket that applies to record. When one is
+// empty no token is taken, and it returns false and the time until every
+// bucket has a token again.
+func (l *rateLimiter) allow(record IP2Locationrecord) (bool, time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Refill and check every bucket first, so a request rejected by one of
+	// them does not use up the others.
+	var buckets []*tokenBucket
+	var wait time.Duration
+	for _, kind := range rateLimitKinds {
+		for _, value := range recordValues(kind, record) {
+			rule := l.specific[kind][value]
+			if rule == nil {
+				rule = l.wildcard[kind]
+			}
+			if rule == nil {
+				continue
+			}
+			b := l.bucket(rule, kind+":"+value, now)
+			if w := time.Duration((1 - b.tokens) / rule.rate * float64(time.Second)); b.tokens < 1 && w > wait {
+				wait = w
+			}
+			buckets = append(buckets, b)
+		}
+	}
+	l.evict(len(buckets))
+	if wait > 0 {
+		return false, wait
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// bucket returns the bucket of rule and value, refilled up to now.
+func (l *rateLimiter) bucket(rule *rateRule, value string, now time.Time) *tokenBucket {
+	key := rule.key + "|" + value
+	if el, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(el)
+		b := el.Value.(*tokenBucket)
+		b.tokens = math.Min(rule.burst, b.tokens+now.Sub(b.last).Seconds()*rule.rate)
+		b.last = now
+		return b
+	}
+
+	b := &tokenBucket{key: key, tokens: rule.burst, last: now}
+	l.buckets[key] = l.lru.PushFront(b)
+	return b
+}
+
+// evict drops the least recently used buckets beyond maxBuckets, but never
+// the inUse most recent ones, which the current request has just fetched.
+func (l *rateLimiter) evict(inUse int) {
+	for l.lru.Len() > l.maxBuckets && l.lru.Len() > inUse {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*tokenBucket).key)
+	}
+}
+
+// reject writes a 429 response asking the client to retry after wait.
+func (l *rateLimiter) reject(rw http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	rw.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(rw, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
@@ -0,0 +1,203 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l, err := newRateLimiter(&Config{RateLimits: map[string]string{
+		"country:RU,CN":  "2/1m",
+		"country:*":      "100/s",
+		"asn:AS16509":    "1/10s",
+		"usage_type:DCH": "3/m",
+	}})
+	if err != nil {
+		t.Fatalf("newRateLimiter failed: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+
+	ru := IP2Locationrecord{Country_short: "RU"}
+	cn := IP2Locationrecord{Country_short: "CN"}
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow(ru); !ok {
+			t.Fatalf("request %d from RU rejected", i+1)
+		}
+	}
+	ok, wait := l.allow(ru)
+	if ok || wait != 30*time.Second {
+		t.Errorf("third request from RU = %v, %s, want rejected with 30s wait", ok, wait)
+	}
+	// each country of an entry has its own bucket
+	if ok, _ := l.allow(cn); !ok {
+		t.Error("request from CN rejected")
+	}
+	now = now.Add(30 * time.Second)
+	if ok, _ := l.allow(ru); !ok {
+		t.Error("request from RU rejected after the refill")
+	}
+
+	// the ASN bucket applies on top of the country wildcard
+	aws := IP2Locationrecord{Country_short: "US", Asn: "16509"}
+	if ok, _ := l.allow(aws); !ok {
+		t.Error("first request from AS16509 rejected")
+	}
+	if ok, _ := l.allow(aws); ok {
+		t.Error("second request from AS16509 allowed")
+	}
+
+	// combined usage types match each code
+	hosting := IP2Locationrecord{Usagetype: "DCH/CDN"}
+	for i := 0; i < 3; i++ {
+		l.allow(hosting)
+	}
+	if ok, _ := l.allow(hosting); ok {
+		t.Error("fourth request from DCH allowed")
+	}
+	if ok, _ := l.allow(IP2Locationrecord{Country_short: "-"}); !ok {
+		t.Error("request with unknown values rejected")
+	}
+}
+
+func TestRateLimiter_RejectKeepsTokens(t *testing.T) {
+	l, err := newRateLimiter(&Config{RateLimits: map[string]string{
+		"country:US":  "5/1m",
+		"asn:AS16509": "1/1m",
+	}})
+	if err != nil {
+		t.Fatalf("newRateLimiter failed: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+
+	aws := IP2Locationrecord{Country_short: "US", Asn: "16509"}
+	if ok, _ := l.allow(aws); !ok {
+		t.Fatal("first request from AS16509 rejected")
+	}
+	// the ASN bucket is empty, the country bucket has room
+	for i := 0; i < 3; i++ {
+		if ok, wait := l.allow(aws); ok || wait != time.Minute {
+			t.Fatalf("request %d from AS16509 = %v, %s, want rejected with 1m wait", i+2, ok, wait)
+		}
+	}
+	if tokens := l.buckets["country:US|country:US"].Value.(*tokenBucket).tokens; tokens != 4 {
+		t.Errorf("country tokens = %v after rejected requests, want 4", tokens)
+	}
+	for i := 0; i < 4; i++ {
+		if ok, _ := l.allow(IP2Locationrecord{Country_short: "US"}); !ok {
+			t.Errorf("request %d from US rejected", i+1)
+		}
+	}
+}
+
+func TestRateLimiter_MaxBuckets(t *testing.T) {
+	l, err := newRateLimiter(&Config{
+		RateLimits:          map[string]string{"country:*": "1/h"},
+		RateLimitMaxBuckets: 2,
+	})
+	if err != nil {
+		t.Fatalf("newRateLimiter failed: %v", err)
+	}
+	for _, country := range []string{"DE", "FR", "IT", "ES"} {
+		l.allow(IP2Locationrecord{Country_short: country})
+	}
+	if l.lru.Len() != 2 || len(l.buckets) != 2 {
+		t.Errorf("kept %d buckets (%d in map), want 2", l.lru.Len(), len(l.buckets))
+	}
+	// the least recently used bucket was dropped and starts full again
+	if ok, _ := l.allow(IP2Locationrecord{Country_short: "DE"}); !ok {
+		t.Error("request from evicted DE bucket rejected")
+	}
+	if ok, _ := l.allow(IP2Locationrecord{Country_short: "DE"}); ok {
+		t.Error("second request from DE allowed")
+	}
+}
+
+func TestRateLimiter_MaxBucketsBelowRules(t *testing.T) {
+	l, err := newRateLimiter(&Config{
+		RateLimits: map[string]string{
+			"country:*":    "1/h",
+			"asn:*":        "1/h",
+			"usage_type:*": "1/h",
+		},
+		RateLimitMaxBuckets: 2,
+	})
+	if err != nil {
+		t.Fatalf("newRateLimiter failed: %v", err)
+	}
+
+	// three buckets apply, one more than may be kept
+	record := IP2Locationrecord{Country_short: "DE", Asn: "3320", Usagetype: "ISP"}
+	if ok, _ := l.allow(record); !ok {
+		t.Fatal("first request rejected")
+	}
+	if ok, _ := l.allow(record); ok {
+		t.Error("second request allowed")
+	}
+
+	// the next request trims the buckets back to the limit
+	l.allow(IP2Locationrecord{Country_short: "FR"})
+	if l.lru.Len() != 2 || len(l.buckets) != 2 {
+		t.Errorf("kept %d buckets (%d in map), want 2", l.lru.Len(), len(l.buckets))
+	}
+}
+
+func TestNewRateLimiter_Invalid(t *testing.T) {
+	tests := []map[string]string{
+		{"city:Berlin": "1/s"},
+		{"country": "1/s"},
+		{"country:": "1/s"},
+		{"country:DE": "1"},
+		{"country:DE": "0/s"},
+		{"country:DE": "1/fortnight"},
+		{"country:DE": "1/s", "country:FR,DE": "2/s"},
+		{"asn:*": "1/s", "asn:* ": "2/s"},
+	}
+	for _, limits := range tests {
+		if _, err := newRateLimiter(&Config{RateLimits: limits}); err == nil {
+			t.Errorf("expected error for %v", limits)
+		}
+	}
+}
+
+func TestGeoIP_RateLimit(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "5.8.0.0", fields: map[string]string{"country_short": "RU"}},
+		{from: "5.9.0.0", fields: map[string]string{"country_short": "DE"}},
+		{from: "5.10.0.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:   dbPath,
+		RateLimits: map[string]string{"country:RU": "1/m"},
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	serve := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/login", nil)
+		req.RemoteAddr = remote
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	if rw := serve("5.8.0.1:1234"); rw.Code != http.StatusOK {
+		t.Errorf("first request from RU: status %d", rw.Code)
+	}
+	rw := serve("5.8.0.2:1234")
+	if rw.Code != http.StatusTooManyRequests {
+		t.Errorf("second request from RU: status %d, want 429", rw.Code)
+	}
+	if got := rw.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if rw := serve("5.9.0.1:1234"); rw.Code != http.StatusOK {
+		t.Errorf("request from DE: status %d", rw.Code)
+	}
+}
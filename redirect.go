@@ -0,0 +1,264 @@
+package traefik_plugin_ip2location
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redirectPlaceholders lists the placeholders allowed in redirect URL templates.
+var redirectPlaceholders = map[string]bool{
+	"country_code":       true,
+	"country_code_lower": true,
+	"continent_code":     true,
+	"host":               true,
+	"path":               true,
+	"query":              true,
+}
+
+// geoRedirect sends clients to a URL chosen by their country or continent.
+type geoRedirect struct {
+	countries  map[string]string
+	continents map[string]string
+	// fallback is used for any other known country, empty for none
+	fallback     string
+	statusCode   int
+	optOutCookie string
+	optOutQuery  string
+}
+
+// newGeoRedirect builds the redirects from the configuration. It returns nil
+// when no redirect is configured. Keys are comma separated country codes,
+// "continent:" followed by continent codes, or "*".
+func newGeoRedirect(config *Config) (*geoRedirect, error) {
+	if len(config.Redirects) == 0 {
+		return nil, nil
+	}
+
+	r := &geoRedirect{
+		countries:    map[string]string{},
+		continents:   map[string]string{},
+		statusCode:   config.RedirectStatusCode,
+		optOutCookie: config.RedirectOptOutCookie,
+		optOutQuery:  config.RedirectOptOutQuery,
+	}
+	switch r.statusCode {
+	case 0:
+		r.statusCode = http.StatusFound
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, fmt.Errorf("invalid redirect_status_code %d, must be 301, 302, 303, 307 or 308", r.statusCode)
+	}
+
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == ' ' })
+	}
+	for key, template := range config.Redirects {
+		if err := checkRedirectTemplate(template); err != nil {
+			return nil, fmt.Errorf("invalid redirect for %q: %w", key, err)
+		}
+
+		key = strings.TrimSpace(key)
+		if key == "*" {
+			r.fallback = template
+			continue
+		}
+
+		target := r.countries
+		var set map[string]bool
+		var err error
+		if rest, ok := strings.CutPrefix(strings.ToLower(key), "continent:"); ok {
+			target = r.continents
+			set, err = continentCodeSet("redirects", split(rest))
+		} else {
+			set, err = countryCodeSet("redirects", split(key))
+		}
+		if err != nil {
+			return nil, err
+		}
+		for code := range set {
+			if _, ok := target[code]; ok {
+				return nil, fmt.Errorf("redirects lists %s more than once", code)
+			}
+			target[code] = template
+		}
+	}
+	return r, nil
+}
+
+// checkRedirectTemplate reports unknown or unterminated placeholders.
+func checkRedirectTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("empty URL")
+	}
+	for rest := template; ; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			return nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return fmt.Errorf("unterminated placeholder in %q", template)
+		}
+		if name := rest[start+1 : start+end]; !redirectPlaceholders[name] {
+			return fmt.Errorf("unknown placeholder {%s} in %q", name, template)
+		}
+		rest = rest[start+end+1:]
+	}
+}
+
+// serve redirects req when its country has a target, the client has not
+// opted out and the request is not already at the target. It reports whether
+// the response was written.
+func (r *geoRedirect) serve(rw http.ResponseWriter, req *http.Request, record IP2Locationrecord) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	if r.optOutQuery != "" {
+		if _, ok := req.URL.Query()[r.optOutQuery]; ok {
+			// remember the choice for the following requests
+			if r.optOutCookie != "" {
+				http.SetCookie(rw, &http.Cookie{Name: r.optOutCookie, Value: "1", Path: "/", MaxAge: 30 * 24 * 3600, SameSite: http.SameSiteLaxMode})
+			}
+			return false
+		}
+	}
+	if r.optOutCookie != "" {
+		if _, err := req.Cookie(r.optOutCookie); err == nil {
+			return false
+		}
+	}
+
+	template := r.templateFor(record)
+	if template == "" {
+		return false
+	}
+
+	// {host} comes from the client, it must not be able to change the
+	// structure of the URL, e.g. with "example.com@evil.com".
+	if strings.Contains(template, "{host}") && !validHost(req.Host) {
+		return false
+	}
+
+	// Without the request parts the template is the location the country
+	// belongs to; requests already there are not redirected again.
+	base := expandRedirect(template, req, record, false)
+	if r.within(req, base) {
+		return false
+	}
+
+	// The request parts must not lead elsewhere either, as a path starting
+	// with "//" would for a template starting with {path}.
+	location := expandRedirect(template, req, record, true)
+	if !sameOrigin(location, base) {
+		return false
+	}
+
+	rw.Header().Set("Location", location)
+	rw.Header().Set("Cache-Control", "private")
+	rw.WriteHeader(r.statusCode)
+	return true
+}
+
+// templateFor returns the URL template for the country of record, or "".
+func (r *geoRedirect) templateFor(record IP2Locationrecord) string {
+	if record.Country_short == "" || record.Country_short == "-" {
+		return ""
+	}
+	if template, ok := r.countries[record.Country_short]; ok {
+		return template
+	}
+	if template, ok := r.continents[record.Continentcode]; ok {
+		return template
+	}
+	return r.fallback
+}
+
+// expandRedirect replaces the placeholders of template. {path} and {query}
+// are left empty unless withRequest is set; {query} includes the "?".
+func expandRedirect(template string, req *http.Request, record IP2Locationrecord, withRequest bool) string {
+	path, query := "", ""
+	if withRequest {
+		path = req.URL.EscapedPath()
+		if req.URL.RawQuery != "" {
+			query = "?" + req.URL.RawQuery
+		}
+	}
+	return strings.NewReplacer(
+		"{country_code}", record.Country_short,
+		"{country_code_lower}", strings.ToLower(record.Country_short),
+		"{continent_code}", record.Continentcode,
+		"{host}", req.Host,
+		"{path}", path,
+		"{query}", query,
+	).Replace(template)
+}
+
+// within reports whether req is on the host of location, at or below its path
+// and carries every query parameter of location.
+func (r *geoRedirect) within(req *http.Request, location string) bool {
+	u, err := url.Parse(location)
+	if err != nil {
+		return false
+	}
+	if u.Host != "" && !strings.EqualFold(hostname(u.Host), hostname(req.Host)) {
+		return false
+	}
+	base := strings.TrimSuffix(u.Path, "/")
+	if base != "" && req.URL.Path != base && !strings.HasPrefix(req.URL.Path, base+"/") {
+		return false
+	}
+
+	// a template may select the storefront with the query alone
+	query := req.URL.Query()
+	for name, values := range u.Query() {
+		for _, v := range values {
+			if !containsString(query[name], v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validHost reports whether host is a plain host name or IP address, with an
+// optional port.
+func validHost(host string) bool {
+	return host != "" && strings.IndexFunc(host, func(c rune) bool {
+		return !(c == '-' || c == '.' || c == ':' || c == '[' || c == ']' || c == '_' ||
+			c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z')
+	}) < 0
+}
+
+// sameOrigin reports whether the URLs a and b have the same scheme and host.
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// hostname returns host without its port.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
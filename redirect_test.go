@@ -0,0 +1,187 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGeoIP_Redirect(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "2.16.0.0", fields: map[string]string{"country_short": "DE"}},
+		{from: "2.17.0.0", fields: map[string]string{"country_short": "FR"}},
+		{from: "2.18.0.0", fields: map[string]string{"country_short": "IT"}},
+		{from: "2.19.0.0", fields: map[string]string{"country_short": "US"}},
+		{from: "2.20.0.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename: dbPath,
+		Redirects: map[string]string{
+			"DE, AT":       "/{country_code_lower}{path}{query}",
+			"FR":           "https://fr.example.com{path}{query}",
+			"continent:EU": "https://eu.example.com{path}",
+		},
+		RedirectStatusCode:   http.StatusTemporaryRedirect,
+		RedirectOptOutCookie: "no_geo_redirect",
+		RedirectOptOutQuery:  "stay",
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		remote   string
+		cookie   bool
+		location string
+	}{
+		{name: "country path prefix", target: "http://example.com/shop?id=1", remote: "2.16.0.1:1234", location: "/de/shop?id=1"},
+		{name: "already at country path", target: "http://example.com/de/shop", remote: "2.16.0.1:1234"},
+		{name: "path sharing the prefix", target: "http://example.com/dev", remote: "2.16.0.1:1234", location: "/de/dev"},
+		{name: "country host", target: "http://example.com/a", remote: "2.17.0.1:1234", location: "https://fr.example.com/a"},
+		{name: "already on country host", target: "http://fr.example.com:8080/a", remote: "2.17.0.1:1234"},
+		{name: "continent", target: "http://example.com/a?b=c", remote: "2.18.0.1:1234", location: "https://eu.example.com/a"},
+		{name: "no match", target: "http://example.com/a", remote: "2.19.0.1:1234"},
+		{name: "unknown country", target: "http://example.com/a", remote: "2.20.0.1:1234"},
+		{name: "not GET", method: http.MethodPost, target: "http://example.com/a", remote: "2.16.0.1:1234"},
+		{name: "opt-out query", target: "http://example.com/a?stay", remote: "2.16.0.1:1234"},
+		{name: "opt-out cookie", target: "http://example.com/a", remote: "2.16.0.1:1234", cookie: true},
+	}
+	for _, tt := range tests {
+		method := tt.method
+		if method == "" {
+			method = http.MethodGet
+		}
+		req := httptest.NewRequest(method, tt.target, nil)
+		req.RemoteAddr = tt.remote
+		if tt.cookie {
+			req.AddCookie(&http.Cookie{Name: "no_geo_redirect", Value: "1"})
+		}
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		if tt.location == "" {
+			if rw.Code != http.StatusOK || rw.Header().Get("Location") != "" {
+				t.Errorf("%s: got %d to %q, want no redirect", tt.name, rw.Code, rw.Header().Get("Location"))
+			}
+			continue
+		}
+		if rw.Code != http.StatusTemporaryRedirect {
+			t.Errorf("%s: status = %d, want %d", tt.name, rw.Code, http.StatusTemporaryRedirect)
+		}
+		if got := rw.Header().Get("Location"); got != tt.location {
+			t.Errorf("%s: Location = %q, want %q", tt.name, got, tt.location)
+		}
+	}
+
+	// the opt-out query flag sets the cookie
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/a?stay=1", nil)
+	req.RemoteAddr = "2.16.0.1:1234"
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	if cookies := rw.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != "no_geo_redirect" {
+		t.Errorf("expected the opt-out cookie, got %v", cookies)
+	}
+}
+
+func TestGeoIP_RedirectQueryOnly(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "2.19.0.0", fields: map[string]string{"country_short": "US"}},
+		{from: "2.20.0.0"},
+	})
+
+	// the template keeps the host and path and only sets the query
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:  dbPath,
+		Redirects: map[string]string{"US": "https://example.com/?region={country_code_lower}"},
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		target   string
+		location string
+	}{
+		{"http://example.com/", "https://example.com/?region=us"},
+		{"http://example.com/?region=de", "https://example.com/?region=us"},
+		{"http://example.com/?region=us", ""},
+		{"http://example.com/a?x=1&region=us", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.RemoteAddr = "2.19.0.1:1234"
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		if got := rw.Header().Get("Location"); got != tt.location {
+			t.Errorf("%s: Location = %q, want %q", tt.target, got, tt.location)
+		}
+	}
+}
+
+func TestGeoIP_RedirectOrigin(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "2.16.0.0", fields: map[string]string{"country_short": "DE"}},
+		{from: "2.17.0.0", fields: map[string]string{"country_short": "FR"}},
+		{from: "2.18.0.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename: dbPath,
+		Redirects: map[string]string{
+			"DE": "{path}?lang=de",
+			"FR": "https://{host}/fr{path}",
+		},
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		host     string
+		path     string
+		remote   string
+		location string
+	}{
+		{"path", "example.com", "/a", "2.16.0.1:1234", "/a?lang=de"},
+		{"path starting with //", "example.com", "//evil.com/a", "2.16.0.1:1234", ""},
+		{"host", "example.com:8443", "/a", "2.17.0.1:1234", "https://example.com:8443/fr/a"},
+		{"host with userinfo", "example.com@evil.com", "/a", "2.17.0.1:1234", ""},
+		{"host with path", "evil.com/x", "/a", "2.17.0.1:1234", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.Host = tt.host
+		req.URL.Path = tt.path
+		req.RemoteAddr = tt.remote
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		if got := rw.Header().Get("Location"); got != tt.location {
+			t.Errorf("%s: Location = %q, want %q", tt.name, got, tt.location)
+		}
+	}
+}
+
+func TestNewGeoRedirect_Invalid(t *testing.T) {
+	tests := []*Config{
+		{Redirects: map[string]string{"DE": "/{country}{path}"}},
+		{Redirects: map[string]string{"DE": "/{path"}},
+		{Redirects: map[string]string{"DE": ""}},
+		{Redirects: map[string]string{"GER": "/de"}},
+		{Redirects: map[string]string{"continent:XX": "/xx"}},
+		{Redirects: map[string]string{"DE": "/de", "AT,DE": "/at"}},
+		{Redirects: map[string]string{"DE": "/de"}, RedirectStatusCode: 200},
+	}
+	for _, config := range tests {
+		if _, err := newGeoRedirect(config); err == nil {
+			t.Errorf("expected error for %v (status %d)", config.Redirects, config.RedirectStatusCode)
+		}
+	}
+}
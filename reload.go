@@ -0,0 +1,202 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// closer is implemented by every database reader.
+type closer interface {
+	Close()
+}
+
+// dbHandle is one opened generation of a database file. The handle is closed
+// only once every lookup that acquired it has released it.
+type dbHandle struct {
+	db       closer
+	inflight sync.WaitGroup
+}
+
+func (h *dbHandle) release() {
+	h.inflight.Done()
+}
+
+// fileStat identifies a version of a database file on disk.
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileStat, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}, err
+	}
+	return fileStat{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// reloader swaps in a new version of a database file when it changes on disk.
+// Polling is used instead of inotify so it works under Yaegi on any platform.
+type reloader struct {
+	name string
+	path string
+	open func(path string) (closer, error)
+	// onSwap, if set, is called after a new version has been swapped in and
+	// the lookups on the previous one have finished
+	onSwap func()
+
+	mu      sync.RWMutex
+	current *dbHandle
+
+	// only touched by the polling goroutine
+	loaded  fileStat
+	pending fileStat
+	failed  fileStat
+}
+
+func newReloader(name, path string, db closer, open func(path string) (closer, error)) *reloader {
+	r := &reloader{name: name, path: path, open: open, current: &dbHandle{db: db}}
+	r.loaded, _ = statFile(path)
+	return r
+}
+
+// acquire returns the current handle. Callers must release it when done.
+func (r *reloader) acquire() *dbHandle {
+	r.mu.RLock()
+	h := r.current
+	h.inflight.Add(1)
+	r.mu.RUnlock()
+	return h
+}
+
+// swap installs db, then calls onSwap and closes the previous handle in the
+// background once its in-flight lookups have finished.
+func (r *reloader) swap(db closer) {
+	r.mu.Lock()
+	old := r.current
+	r.current = &dbHandle{db: db}
+	r.mu.Unlock()
+
+	go func() {
+		old.inflight.Wait()
+		if r.onSwap != nil {
+			r.onSwap()
+		}
+		old.db.Close()
+	}()
+}
+
+// check reloads the file when it has changed and then stayed unchanged for
+// one polling interval, so that a file still being copied is not picked up.
+func (r *reloader) check() {
+	st, err := statFile(r.path)
+	if err != nil || st == r.loaded || st == r.failed {
+		r.pending = fileStat{}
+		return
+	}
+	if st != r.pending {
+		r.pending = st
+		return
+	}
+
+	db, err := r.open(r.path)
+	if err != nil {
+		log.Printf("[%s] keeping current database, failed to reload %s: %v", r.name, r.path, err)
+		r.failed = st
+		return
+	}
+	r.swap(db)
+	r.loaded = st
+	r.pending = fileStat{}
+	log.Printf("[%s] reloaded database %s", r.name, r.path)
+}
+
+func (r *reloader) Close() {
+	r.mu.Lock()
+	h := r.current
+	r.mu.Unlock()
+	h.inflight.Wait()
+	h.db.Close()
+}
+
+// watch polls the reloaders every interval until ctx is done.
+func watch(ctx context.Context, interval time.Duration, reloaders []*reloader) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, r := range reloaders {
+				r.check()
+			}
+		}
+	}
+}
+
+// reloadableDB is a Locator backed by a reloader.
+type reloadableDB struct {
+	*reloader
+}
+
+func newReloadableDB(name, path string, db Locator, inMemory bool) reloadableDB {
+	return reloadableDB{newReloader(name, path, db, func(path string) (closer, error) {
+		db, err := OpenDatabase(path, inMemory)
+		if err != nil {
+			return nil, err
+		}
+		// make sure the new file is readable before it takes traffic
+		if _, err := db.Get_all("8.8.8.8"); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
+	})}
+}
+
+func (r reloadableDB) Get_all(ipaddress string) (IP2Locationrecord, error) {
+	h := r.acquire()
+	defer h.release()
+	return h.db.(Locator).Get_all(ipaddress)
+}
+
+func (r reloadableDB) getAllRange(ipaddress string) (IP2Locationrecord, ipRange, error) {
+	h := r.acquire()
+	defer h.release()
+	return getAllRange(h.db.(Locator), ipaddress)
+}
+
+// proxyLocator is implemented by *ProxyDB and its reloadable wrapper.
+type proxyLocator interface {
+	Get_all(ipaddress string) (IP2Proxyrecord, error)
+	Close()
+}
+
+// reloadableProxyDB is a proxyLocator backed by a reloader.
+type reloadableProxyDB struct {
+	*reloader
+}
+
+func newReloadableProxyDB(name, path string, db *ProxyDB, inMemory bool) reloadableProxyDB {
+	return reloadableProxyDB{newReloader(name, path, db, func(path string) (closer, error) {
+		db, err := openProxyDB(path, inMemory)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := db.Get_all("8.8.8.8"); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
+	})}
+}
+
+func (r reloadableProxyDB) Get_all(ipaddress string) (IP2Proxyrecord, error) {
+	h := r.acquire()
+	defer h.release()
+	return h.db.(*ProxyDB).Get_all(ipaddress)
+}
@@ -0,0 +1,130 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type closerMock struct {
+	closed int32
+}
+
+func (c *closerMock) Close() {
+	atomic.StoreInt32(&c.closed, 1)
+}
+
+func (c *closerMock) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func TestReloader_ClosesAfterInflight(t *testing.T) {
+	old := &closerMock{}
+	r := newReloader("test", "nonexistent.bin", old, nil)
+
+	h := r.acquire()
+	r.swap(&closerMock{})
+
+	time.Sleep(20 * time.Millisecond)
+	if old.isClosed() {
+		t.Fatal("old database closed while a lookup was still in flight")
+	}
+
+	h.release()
+
+	deadline := time.Now().Add(time.Second)
+	for !old.isClosed() {
+		if time.Now().After(deadline) {
+			t.Fatal("old database not closed after the in-flight lookup finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReloader_SwapWaitsForInflight(t *testing.T) {
+	r := newReloader("test", "nonexistent.bin", &closerMock{}, nil)
+	var swapped int32
+	r.onSwap = func() { atomic.StoreInt32(&swapped, 1) }
+
+	h := r.acquire()
+	r.swap(&closerMock{})
+
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&swapped) == 1 {
+		t.Fatal("onSwap called while a lookup on the old database was in flight")
+	}
+
+	h.release()
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&swapped) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("onSwap not called after the in-flight lookup finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestGeoIP_Reload tests that a replaced database file is picked up without restarting
+func TestGeoIP_Reload(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "1.2.3.0", fields: map[string]string{"country_short": "DE"}},
+	})
+	newPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "1.2.3.0", fields: map[string]string{"country_short": "AT"}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := &Config{
+		Filename:       dbPath,
+		CountryCode:    "X-Country-Code",
+		ReloadInterval: "10ms",
+		CacheSize:      10,
+	}
+
+	handler, err := New(ctx, &httpHandlerMock{}, config, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	country := func() string {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/some/path", nil)
+		req.RemoteAddr = "1.2.3.4:34000"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return req.Header.Get("X-Country-Code")
+	}
+
+	if got := country(); got != "DE" {
+		t.Fatalf("country before reload = %q, want DE", got)
+	}
+
+	if err := os.Rename(newPath, dbPath); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(dbPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for country() != "AT" {
+		if time.Now().After(deadline) {
+			t.Fatal("database was not reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestGeoIP_InvalidReloadInterval(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, nil)
+	config := &Config{Filename: dbPath, ReloadInterval: "soon"}
+	if _, err := New(context.Background(), &httpHandlerMock{}, config, "test"); err == nil {
+		t.Fatal("Expected error for invalid reload_interval")
+	}
+}
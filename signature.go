@@ -0,0 +1,144 @@
+package traefik_plugin_ip2location
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signer adds an HMAC-SHA256 signature over the client IP, a timestamp and
+// the headers the plugin set on a request, so that backends reachable without
+// Traefik in front can tell them from client supplied ones. The signature
+// header has the form
+//
+//	t=<unix seconds>;ip=<client IP>;h=<signed header names>;sig=<base64url HMAC>
+//
+// and is checked with Verify.
+type signer struct {
+	header string
+	secret []byte
+	now    func() time.Time
+}
+
+// newSigner builds the signer from the configuration. It returns nil when
+// signature_header is not set.
+func newSigner(config *Config) (*signer, error) {
+	if config.SignatureHeader == "" {
+		return nil, nil
+	}
+	if config.SignatureSecret == "" {
+		return nil, fmt.Errorf("signature_secret is required with signature_header")
+	}
+	return &signer{header: config.SignatureHeader, secret: []byte(config.SignatureSecret), now: time.Now}, nil
+}
+
+// sign sets the signature header over those of names present in header.
+func (s *signer) sign(header http.Header, ip net.IP, names []string) {
+	seen := map[string]bool{strings.ToLower(s.header): true}
+	var signed []string
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if seen[name] || len(header.Values(name)) == 0 {
+			continue
+		}
+		seen[name] = true
+		signed = append(signed, name)
+	}
+	sort.Strings(signed)
+
+	clientIP := ""
+	if ip != nil {
+		clientIP = ip.String()
+	}
+	timestamp := s.now().Unix()
+	mac := signatureMAC(s.secret, timestamp, clientIP, signed, header)
+
+	header.Set(s.header, fmt.Sprintf("t=%d;ip=%s;h=%s;sig=%s",
+		timestamp, clientIP, strings.Join(signed, ","), base64.RawURLEncoding.EncodeToString(mac)))
+}
+
+// signatureMAC computes the HMAC over the timestamp, the client IP and the
+// lowercase name and value of each signed header, one per line.
+func signatureMAC(secret []byte, timestamp int64, clientIP string, names []string, header http.Header) []byte {
+	h := hmac.New(sha256.New, secret)
+	fmt.Fprintf(h, "v1\n%d\n%s", timestamp, clientIP)
+	for _, name := range names {
+		fmt.Fprintf(h, "\n%s:%s", name, header.Get(name))
+	}
+	return h.Sum(nil)
+}
+
+// VerifiedHeaders is the result of a successful Verify.
+type VerifiedHeaders struct {
+	// ClientIP is the client IP the plugin resolved, empty if it could not.
+	ClientIP string
+	// Time is when the plugin signed the request.
+	Time time.Time
+	// Values holds the signed header values by canonical header name.
+	Values map[string]string
+}
+
+// Verify checks the signature the plugin added to header in signatureHeader
+// using the shared secret, and that it is at most maxAge old (0 skips that
+// check). On success it returns the client IP and the signed header values.
+// Geo headers missing from Values were not set by the plugin and must not be
+// trusted.
+func Verify(header http.Header, signatureHeader, secret string, maxAge time.Duration) (*VerifiedHeaders, error) {
+	return verifyAt(header, signatureHeader, secret, maxAge, time.Now())
+}
+
+func verifyAt(header http.Header, signatureHeader, secret string, maxAge time.Duration, now time.Time) (*VerifiedHeaders, error) {
+	values := header.Values(signatureHeader)
+	if len(values) != 1 {
+		return nil, fmt.Errorf("expected one %s header, got %d", signatureHeader, len(values))
+	}
+
+	params := map[string]string{}
+	for _, part := range strings.Split(values[0], ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed %s header", signatureHeader)
+		}
+		params[k] = v
+	}
+
+	timestamp, err := strconv.ParseInt(params["t"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed timestamp in %s header", signatureHeader)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(params["sig"])
+	if err != nil || len(sig) == 0 {
+		return nil, fmt.Errorf("malformed signature in %s header", signatureHeader)
+	}
+	var names []string
+	if params["h"] != "" {
+		names = strings.Split(params["h"], ",")
+	}
+
+	verified := &VerifiedHeaders{
+		ClientIP: params["ip"],
+		Time:     time.Unix(timestamp, 0),
+		Values:   make(map[string]string, len(names)),
+	}
+	for _, name := range names {
+		if n := len(header.Values(name)); n != 1 {
+			return nil, fmt.Errorf("expected one signed %s header, got %d", name, n)
+		}
+		verified.Values[http.CanonicalHeaderKey(name)] = header.Get(name)
+	}
+
+	if !hmac.Equal(sig, signatureMAC([]byte(secret), timestamp, verified.ClientIP, names, header)) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	if age := now.Sub(verified.Time); maxAge > 0 && (age > maxAge || age < -maxAge) {
+		return nil, fmt.Errorf("signature is %s old, more than %s", age, maxAge)
+	}
+	return verified, nil
+}
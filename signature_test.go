@@ -0,0 +1,105 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSigner_Verify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := &signer{header: "X-Geo-Signature", secret: []byte("s3cret"), now: func() time.Time { return now }}
+
+	header := http.Header{}
+	header.Set("X-Geo-Country-Code", "GB")
+	header.Set("X-Geo-City", "London")
+	header.Set("Authorization", "Bearer x")
+	s.sign(header, net.ParseIP("81.2.69.160"), []string{"X-Geo-Country-Code", "X-Geo-City", "X-Geo-Asn", "X-Geo-Signature"})
+
+	verified, err := verifyAt(header, "X-Geo-Signature", "s3cret", time.Minute, now.Add(30*time.Second))
+	if err != nil {
+		t.Fatalf("verify failed: %v (header %q)", err, header.Get("X-Geo-Signature"))
+	}
+	if verified.ClientIP != "81.2.69.160" || !verified.Time.Equal(now) {
+		t.Errorf("unexpected result %+v", verified)
+	}
+	want := map[string]string{"X-Geo-Country-Code": "GB", "X-Geo-City": "London"}
+	if len(verified.Values) != len(want) {
+		t.Errorf("Values = %v, want %v", verified.Values, want)
+	}
+	for k, v := range want {
+		if verified.Values[k] != v {
+			t.Errorf("Values[%s] = %q, want %q", k, verified.Values[k], v)
+		}
+	}
+
+	tamper := func(f func(h http.Header)) http.Header {
+		h := header.Clone()
+		f(h)
+		return h
+	}
+	tests := map[string]struct {
+		header http.Header
+		secret string
+		at     time.Time
+	}{
+		"wrong secret":   {header, "other", now},
+		"expired":        {header, "s3cret", now.Add(2 * time.Minute)},
+		"from future":    {header, "s3cret", now.Add(-2 * time.Minute)},
+		"changed value":  {tamper(func(h http.Header) { h.Set("X-Geo-Country-Code", "US") }), "s3cret", now},
+		"removed header": {tamper(func(h http.Header) { h.Del("X-Geo-City") }), "s3cret", now},
+		"second value":   {tamper(func(h http.Header) { h.Add("X-Geo-Country-Code", "US") }), "s3cret", now},
+		"missing":        {tamper(func(h http.Header) { h.Del("X-Geo-Signature") }), "s3cret", now},
+		"malformed":      {tamper(func(h http.Header) { h.Set("X-Geo-Signature", "garbage") }), "s3cret", now},
+	}
+	for name, tt := range tests {
+		if _, err := verifyAt(tt.header, "X-Geo-Signature", tt.secret, time.Minute, tt.at); err == nil {
+			t.Errorf("%s: expected verification to fail", name)
+		}
+	}
+
+	if _, err := verifyAt(header, "X-Geo-Signature", "s3cret", 0, now.Add(24*time.Hour)); err != nil {
+		t.Errorf("verify without max age failed: %v", err)
+	}
+}
+
+func TestGeoIP_SignatureHeader(t *testing.T) {
+	dbPath := buildTestBIN(t, 1, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.70.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:        dbPath,
+		CountryCode:     "X-Country-Code",
+		SignatureHeader: "X-Geo-Signature",
+		SignatureSecret: "s3cret",
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.RemoteAddr = "81.2.69.160:1234"
+	req.Header.Set("X-Geo-Signature", "t=0;ip=;h=;sig=forged")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	verified, err := Verify(req.Header, "X-Geo-Signature", "s3cret", time.Minute)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if verified.ClientIP != "81.2.69.160" || verified.Values["X-Country-Code"] != "GB" {
+		t.Errorf("unexpected result %+v", verified)
+	}
+
+	_, err = New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:        dbPath,
+		SignatureHeader: "X-Geo-Signature",
+	}, "test")
+	if err == nil {
+		t.Error("Expected error for signature_header without signature_secret")
+	}
+}
@@ -0,0 +1,87 @@
+package traefik_plugin_ip2location
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// earthRadiusKm is the mean radius of the Earth.
+const earthRadiusKm = 6371.0088
+
+// site is a configured location distances are measured to.
+type site struct {
+	name     string
+	lat, lon float64
+}
+
+// parseSites parses the sites option, mapping names to "latitude,longitude".
+// The sites are returned sorted by name so ties resolve the same way.
+func parseSites(config map[string]string) ([]site, error) {
+	sites := make([]site, 0, len(config))
+	for name, coords := range config {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.IndexFunc(name, func(c rune) bool {
+			return !(c == '-' || c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z')
+		}) >= 0 {
+			return nil, fmt.Errorf("invalid site name %q, use letters, digits, '-', '_' and '.'", name)
+		}
+
+		latStr, lonStr, ok := strings.Cut(coords, ",")
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+		if !ok || latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("invalid coordinates %q for site %s, must be \"latitude,longitude\"", coords, name)
+		}
+		sites = append(sites, site{name: name, lat: lat, lon: lon})
+	}
+	sort.Slice(sites, func(i, j int) bool { return sites[i].name < sites[j].name })
+	return sites, nil
+}
+
+// distanceKm returns the great-circle distance between two points with the
+// haversine formula.
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// addSiteHeaders sets the nearest site, its distance and the distance to
+// every site. Nothing is set when the record has no coordinates.
+func (g *GeoIP) addSiteHeaders(header http.Header, record IP2Locationrecord) {
+	if len(g.sites) == 0 || (record.Latitude == 0 && record.Longitude == 0) {
+		return
+	}
+	if g.nearestSite == "" && g.nearestSiteDistance == "" && g.siteDistance == "" {
+		return
+	}
+
+	nearest, nearestKm := "", math.Inf(1)
+	for _, s := range g.sites {
+		km := distanceKm(float64(record.Latitude), float64(record.Longitude), s.lat, s.lon)
+		if km < nearestKm {
+			nearest, nearestKm = s.name, km
+		}
+		if g.siteDistance != "" {
+			header.Set(g.siteDistance+s.name, formatKm(km))
+		}
+	}
+	if g.nearestSite != "" {
+		header.Set(g.nearestSite, nearest)
+	}
+	if g.nearestSiteDistance != "" {
+		header.Set(g.nearestSiteDistance, formatKm(nearestKm))
+	}
+}
+
+// formatKm formats a distance as whole kilometres.
+func formatKm(km float64) string {
+	return strconv.FormatFloat(km, 'f', 0, 64)
+}
@@ -0,0 +1,103 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDistanceKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 50.11, 8.68, 50.11, 8.68, 0},
+		{"London to Paris", 51.5074, -0.1278, 48.8566, 2.3522, 343.6},
+		{"New York to Los Angeles", 40.7128, -74.0060, 34.0522, -118.2437, 3936},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111.2},
+	}
+	for _, tt := range tests {
+		if got := distanceKm(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(got-tt.want) > tt.want*0.005+0.1 {
+			t.Errorf("%s: distanceKm = %.1f, want %.1f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseSites(t *testing.T) {
+	sites, err := parseSites(map[string]string{"fra": "50.11, 8.68", "ams": "52.37,4.90"})
+	if err != nil {
+		t.Fatalf("parseSites failed: %v", err)
+	}
+	if len(sites) != 2 || sites[0].name != "ams" || sites[1].lat != 50.11 {
+		t.Errorf("unexpected sites %+v", sites)
+	}
+
+	for _, config := range []map[string]string{
+		{"fra": "50.11"},
+		{"fra": "91,8.68"},
+		{"fra": "50.11,181"},
+		{"fra": "north,east"},
+		{"fra main": "50.11,8.68"},
+	} {
+		if _, err := parseSites(config); err == nil {
+			t.Errorf("expected error for %v", config)
+		}
+	}
+}
+
+func TestGeoIP_Sites(t *testing.T) {
+	dbPath := buildTestBIN(t, 5, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{
+			"country_short": "GB",
+			"latitude":      "51.5074",
+			"longitude":     "-0.1278",
+		}},
+		{from: "81.2.70.0", fields: map[string]string{"country_short": "GB"}},
+		{from: "81.2.71.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:            dbPath,
+		Sites:               map[string]string{"fra": "50.1109,8.6821", "par": "48.8566,2.3522"},
+		NearestSite:         "X-Nearest-Site",
+		NearestSiteDistance: "X-Nearest-Site-Km",
+		SiteDistance:        "X-Site-Km-",
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.RemoteAddr = "81.2.69.160:1234"
+	req.Header.Set("X-Site-Km-Fra", "1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	expected := map[string]string{
+		"X-Nearest-Site":    "par",
+		"X-Nearest-Site-Km": "344",
+		"X-Site-Km-Par":     "344",
+		"X-Site-Km-Fra":     "638",
+	}
+	for header, want := range expected {
+		if got := req.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	// no coordinates, no headers
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.RemoteAddr = "81.2.70.1:1234"
+	req.Header.Set("X-Nearest-Site", "fra")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got := req.Header.Get("X-Nearest-Site"); got != "" {
+		t.Errorf("X-Nearest-Site = %q without coordinates", got)
+	}
+
+	_, err = New(context.Background(), &httpHandlerMock{}, &Config{Filename: dbPath, NearestSite: "X-Nearest-Site"}, "test")
+	if err == nil {
+		t.Error("Expected error for nearest_site without sites")
+	}
+}
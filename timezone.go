@@ -0,0 +1,453 @@
+package traefik_plugin_ip2location
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// countryZones maps ISO 3166-1 alpha-2 country codes to their IANA time
+// zones. Countries spanning several zones list each zone followed by the
+// coordinates of reference cities in it, separated by ";". A client is
+// assigned the zone of the nearest reference city.
+var countryZones = map[string]string{
+	"AD": "Europe/Andorra",
+	"AE": "Asia/Dubai",
+	"AF": "Asia/Kabul",
+	"AG": "America/Antigua",
+	"AI": "America/Anguilla",
+	"AL": "Europe/Tirane",
+	"AM": "Asia/Yerevan",
+	"AO": "Africa/Luanda",
+	"AQ": "Antarctica/McMurdo -77.85,166.67; Antarctica/Casey -66.28,110.52; Antarctica/Davis -68.58,77.97; " +
+		"Antarctica/Mawson -67.60,62.88; Antarctica/Palmer -64.80,-64.10; Antarctica/Rothera -67.57,-68.13; " +
+		"Antarctica/Syowa -69.01,39.59; Antarctica/Troll -72.01,2.54; Antarctica/Vostok -78.40,106.90; " +
+		"Antarctica/DumontDUrville -66.67,140.02",
+	"AR": "America/Argentina/Buenos_Aires -34.60,-58.38 -38.00,-57.55; America/Argentina/Cordoba -31.42,-64.18 -32.95,-60.65; " +
+		"America/Argentina/Salta -24.78,-65.41 -38.95,-68.06; America/Argentina/Jujuy -24.19,-65.30; " +
+		"America/Argentina/Tucuman -26.82,-65.22; America/Argentina/Catamarca -28.47,-65.78 -43.30,-65.10; " +
+		"America/Argentina/La_Rioja -29.41,-66.86; America/Argentina/San_Juan -31.54,-68.52; " +
+		"America/Argentina/Mendoza -32.89,-68.83; America/Argentina/San_Luis -33.30,-66.34; " +
+		"America/Argentina/Rio_Gallegos -51.62,-69.22; America/Argentina/Ushuaia -54.80,-68.30",
+	"AS": "Pacific/Pago_Pago",
+	"AT": "Europe/Vienna",
+	"AU": "Australia/Sydney -33.87,151.21 -35.28,149.13 -32.93,151.78; Australia/Melbourne -37.81,144.96 -36.76,144.28; " +
+		"Australia/Brisbane -27.47,153.03 -19.26,146.82 -16.92,145.77; Australia/Adelaide -34.93,138.60; " +
+		"Australia/Perth -31.95,115.86 -20.31,118.58; Australia/Hobart -42.88,147.33; " +
+		"Australia/Darwin -12.46,130.84 -23.70,133.88; Australia/Broken_Hill -31.95,141.45; " +
+		"Australia/Eucla -31.68,128.88; Australia/Lord_Howe -31.55,159.08; Antarctica/Macquarie -54.50,158.95",
+	"AW": "America/Aruba",
+	"AX": "Europe/Mariehamn",
+	"AZ": "Asia/Baku",
+	"BA": "Europe/Sarajevo",
+	"BB": "America/Barbados",
+	"BD": "Asia/Dhaka",
+	"BE": "Europe/Brussels",
+	"BF": "Africa/Ouagadougou",
+	"BG": "Europe/Sofia",
+	"BH": "Asia/Bahrain",
+	"BI": "Africa/Bujumbura",
+	"BJ": "Africa/Porto-Novo",
+	"BL": "America/St_Barthelemy",
+	"BM": "Atlantic/Bermuda",
+	"BN": "Asia/Brunei",
+	"BO": "America/La_Paz",
+	"BQ": "America/Kralendijk",
+	"BR": "America/Sao_Paulo -23.55,-46.63 -22.91,-43.17 -15.79,-47.88 -19.92,-43.94 -25.43,-49.27 -30.03,-51.23 -16.68,-49.25; " +
+		"America/Bahia -12.97,-38.50; America/Recife -8.05,-34.90 -5.79,-35.21; " +
+		"America/Fortaleza -3.73,-38.52 -2.53,-44.30 -5.09,-42.80; America/Maceio -9.67,-35.74 -10.91,-37.07; " +
+		"America/Belem -1.46,-48.49 0.03,-51.07; America/Araguaina -7.19,-48.21 -10.18,-48.33; " +
+		"America/Santarem -2.44,-54.71; America/Manaus -3.12,-60.02; America/Boa_Vista 2.82,-60.67; " +
+		"America/Porto_Velho -8.76,-63.90; America/Cuiaba -15.60,-56.10; America/Campo_Grande -20.47,-54.62; " +
+		"America/Rio_Branco -9.97,-67.81; America/Eirunepe -6.66,-69.87; America/Noronha -3.85,-32.42",
+	"BS": "America/Nassau",
+	"BT": "Asia/Thimphu",
+	"BW": "Africa/Gaborone",
+	"BY": "Europe/Minsk",
+	"BZ": "America/Belize",
+	"CA": "America/Toronto 43.65,-79.38 45.42,-75.70 45.50,-73.57 46.81,-71.21 48.38,-89.25; " +
+		"America/Halifax 44.65,-63.57 46.24,-63.13; America/Moncton 46.09,-64.78 45.27,-66.06; " +
+		"America/Glace_Bay 46.20,-59.96; America/Goose_Bay 53.30,-60.33; America/St_Johns 47.56,-52.71 48.95,-57.95; " +
+		"America/Blanc-Sablon 51.43,-57.13; America/Atikokan 48.76,-91.62; America/Iqaluit 63.75,-68.52; " +
+		"America/Winnipeg 49.90,-97.14 49.85,-99.95; America/Rankin_Inlet 62.81,-92.08; America/Resolute 74.70,-94.83; " +
+		"America/Regina 50.45,-104.61 52.13,-106.67; America/Swift_Current 50.29,-107.80; " +
+		"America/Edmonton 53.55,-113.49 51.05,-114.07 62.45,-114.37; America/Cambridge_Bay 69.12,-105.06; " +
+		"America/Inuvik 68.36,-133.72; America/Creston 49.10,-116.51; America/Dawson_Creek 55.76,-120.24; " +
+		"America/Fort_Nelson 58.81,-122.70; America/Whitehorse 60.72,-135.05; America/Dawson 64.06,-139.43; " +
+		"America/Vancouver 49.28,-123.12 48.43,-123.37 49.89,-119.50 53.92,-122.75",
+	"CC": "Indian/Cocos",
+	"CD": "Africa/Kinshasa -4.32,15.31 0.05,18.26; Africa/Lubumbashi -11.66,27.48 0.52,25.19 -2.51,28.86",
+	"CF": "Africa/Bangui",
+	"CG": "Africa/Brazzaville",
+	"CH": "Europe/Zurich",
+	"CI": "Africa/Abidjan",
+	"CK": "Pacific/Rarotonga",
+	"CL": "America/Santiago -33.45,-70.67 -36.83,-73.05 -23.65,-70.40; America/Punta_Arenas -53.16,-70.91; Pacific/Easter -27.15,-109.43",
+	"CM": "Africa/Douala",
+	"CN": "Asia/Shanghai 31.23,121.47 39.90,116.41 30.57,104.07 23.13,113.26; Asia/Urumqi 43.83,87.62 39.47,75.99",
+	"CO": "America/Bogota",
+	"CR": "America/Costa_Rica",
+	"CU": "America/Havana",
+	"CV": "Atlantic/Cape_Verde",
+	"CW": "America/Curacao",
+	"CX": "Indian/Christmas",
+	"CY": "Asia/Nicosia 35.17,33.37 34.68,33.04; Asia/Famagusta 35.12,33.94",
+	"CZ": "Europe/Prague",
+	"DE": "Europe/Berlin",
+	"DJ": "Africa/Djibouti",
+	"DK": "Europe/Copenhagen",
+	"DM": "America/Dominica",
+	"DO": "America/Santo_Domingo",
+	"DZ": "Africa/Algiers",
+	"EC": "America/Guayaquil -2.17,-79.92 -0.18,-78.47; Pacific/Galapagos -0.90,-89.61",
+	"EE": "Europe/Tallinn",
+	"EG": "Africa/Cairo",
+	"EH": "Africa/El_Aaiun",
+	"ER": "Africa/Asmara",
+	"ES": "Europe/Madrid 40.42,-3.70 41.39,2.17 37.39,-5.98 39.57,2.65; Africa/Ceuta 35.89,-5.32 35.29,-2.94; " +
+		"Atlantic/Canary 28.12,-15.43 28.47,-16.25",
+	"ET": "Africa/Addis_Ababa",
+	"FI": "Europe/Helsinki",
+	"FJ": "Pacific/Fiji",
+	"FK": "Atlantic/Stanley",
+	"FM": "Pacific/Chuuk 7.45,151.85; Pacific/Pohnpei 6.96,158.21; Pacific/Kosrae 5.33,163.01",
+	"FO": "Atlantic/Faroe",
+	"FR": "Europe/Paris",
+	"GA": "Africa/Libreville",
+	"GB": "Europe/London",
+	"GD": "America/Grenada",
+	"GE": "Asia/Tbilisi",
+	"GF": "America/Cayenne",
+	"GG": "Europe/Guernsey",
+	"GH": "Africa/Accra",
+	"GI": "Europe/Gibraltar",
+	"GL": "America/Nuuk 64.18,-51.72 60.72,-46.03; America/Danmarkshavn 76.77,-18.67; " +
+		"America/Scoresbysund 70.49,-21.97; America/Thule 76.53,-68.70",
+	"GM": "Africa/Banjul",
+	"GN": "Africa/Conakry",
+	"GP": "America/Guadeloupe",
+	"GQ": "Africa/Malabo",
+	"GR": "Europe/Athens",
+	"GS": "Atlantic/South_Georgia",
+	"GT": "America/Guatemala",
+	"GU": "Pacific/Guam",
+	"GW": "Africa/Bissau",
+	"GY": "America/Guyana",
+	"HK": "Asia/Hong_Kong",
+	"HN": "America/Tegucigalpa",
+	"HR": "Europe/Zagreb",
+	"HT": "America/Port-au-Prince",
+	"HU": "Europe/Budapest",
+	"ID": "Asia/Jakarta -6.21,106.85 -7.25,112.75 3.59,98.67 -2.99,104.76; Asia/Pontianak -0.03,109.33 -1.27,116.83; " +
+		"Asia/Makassar -5.15,119.43 -8.65,115.22 1.47,124.84; Asia/Jayapura -2.53,140.72 -3.70,128.18 -0.87,134.06",
+	"IE": "Europe/Dublin",
+	"IL": "Asia/Jerusalem",
+	"IM": "Europe/Isle_of_Man",
+	"IN": "Asia/Kolkata",
+	"IO": "Indian/Chagos",
+	"IQ": "Asia/Baghdad",
+	"IR": "Asia/Tehran",
+	"IS": "Atlantic/Reykjavik",
+	"IT": "Europe/Rome",
+	"JE": "Europe/Jersey",
+	"JM": "America/Jamaica",
+	"JO": "Asia/Amman",
+	"JP": "Asia/Tokyo",
+	"KE": "Africa/Nairobi",
+	"KG": "Asia/Bishkek",
+	"KH": "Asia/Phnom_Penh",
+	"KI": "Pacific/Tarawa 1.42,173.00; Pacific/Kanton -2.78,-171.72; Pacific/Kiritimati 1.87,-157.33",
+	"KM": "Indian/Comoro",
+	"KN": "America/St_Kitts",
+	"KP": "Asia/Pyongyang",
+	"KR": "Asia/Seoul",
+	"KW": "Asia/Kuwait",
+	"KY": "America/Cayman",
+	"KZ": "Asia/Almaty 43.24,76.95 51.17,71.45 49.81,73.10 52.29,76.97; Asia/Qyzylorda 44.85,65.51 42.32,69.59; " +
+		"Asia/Qostanay 53.21,63.63; Asia/Aqtobe 50.28,57.17; Asia/Aqtau 43.65,51.16; Asia/Atyrau 47.11,51.92; " +
+		"Asia/Oral 51.23,51.37",
+	"LA": "Asia/Vientiane",
+	"LB": "Asia/Beirut",
+	"LC": "America/St_Lucia",
+	"LI": "Europe/Vaduz",
+	"LK": "Asia/Colombo",
+	"LR": "Africa/Monrovia",
+	"LS": "Africa/Maseru",
+	"LT": "Europe/Vilnius",
+	"LU": "Europe/Luxembourg",
+	"LV": "Europe/Riga",
+	"LY": "Africa/Tripoli",
+	"MA": "Africa/Casablanca",
+	"MC": "Europe/Monaco",
+	"MD": "Europe/Chisinau",
+	"ME": "Europe/Podgorica",
+	"MF": "America/Marigot",
+	"MG": "Indian/Antananarivo",
+	"MH": "Pacific/Majuro 7.09,171.38; Pacific/Kwajalein 8.72,167.73",
+	"MK": "Europe/Skopje",
+	"ML": "Africa/Bamako",
+	"MM": "Asia/Yangon",
+	"MN": "Asia/Ulaanbaatar 47.89,106.91 49.49,105.92; Asia/Hovd 48.01,91.64 49.98,92.07; Asia/Choibalsan 48.07,114.53",
+	"MO": "Asia/Macau",
+	"MP": "Pacific/Saipan",
+	"MQ": "America/Martinique",
+	"MR": "Africa/Nouakchott",
+	"MS": "America/Montserrat",
+	"MT": "Europe/Malta",
+	"MU": "Indian/Mauritius",
+	"MV": "Indian/Maldives",
+	"MW": "Africa/Blantyre",
+	"MX": "America/Mexico_City 19.43,-99.13 20.67,-103.35 19.04,-98.21 21.88,-102.29 16.75,-93.12 17.06,-96.73; " +
+		"America/Monterrey 25.67,-100.31 25.42,-101.00; America/Matamoros 25.87,-97.50; " +
+		"America/Merida 20.97,-89.62 19.85,-90.53; America/Cancun 21.16,-86.85 18.50,-88.30; " +
+		"America/Chihuahua 28.63,-106.09; America/Ciudad_Juarez 31.74,-106.49; America/Ojinaga 29.56,-104.42; " +
+		"America/Mazatlan 23.22,-106.42 24.81,-107.39 24.14,-110.31; America/Bahia_Banderas 20.80,-105.25; " +
+		"America/Hermosillo 29.07,-110.96; America/Tijuana 32.53,-117.02 32.62,-115.45",
+	"MY": "Asia/Kuala_Lumpur 3.14,101.69 5.41,100.33; Asia/Kuching 1.55,110.35 5.98,116.07",
+	"MZ": "Africa/Maputo",
+	"NA": "Africa/Windhoek",
+	"NC": "Pacific/Noumea",
+	"NE": "Africa/Niamey",
+	"NF": "Pacific/Norfolk",
+	"NG": "Africa/Lagos",
+	"NI": "America/Managua",
+	"NL": "Europe/Amsterdam",
+	"NO": "Europe/Oslo",
+	"NP": "Asia/Kathmandu",
+	"NR": "Pacific/Nauru",
+	"NU": "Pacific/Niue",
+	"NZ": "Pacific/Auckland -36.85,174.76 -41.29,174.78 -43.53,172.64; Pacific/Chatham -43.95,-176.56",
+	"OM": "Asia/Muscat",
+	"PA": "America/Panama",
+	"PE": "America/Lima",
+	"PF": "Pacific/Tahiti -17.53,-149.57; Pacific/Marquesas -9.00,-139.50; Pacific/Gambier -23.13,-134.95",
+	"PG": "Pacific/Port_Moresby -9.44,147.18 -6.73,147.00; Pacific/Bougainville -6.23,155.57",
+	"PH": "Asia/Manila",
+	"PK": "Asia/Karachi",
+	"PL": "Europe/Warsaw",
+	"PM": "America/Miquelon",
+	"PN": "Pacific/Pitcairn",
+	"PR": "America/Puerto_Rico",
+	"PS": "Asia/Gaza 31.50,34.47; Asia/Hebron 31.53,35.10 31.90,35.20 32.22,35.26",
+	"PT": "Europe/Lisbon 38.72,-9.14 41.15,-8.61; Atlantic/Madeira 32.65,-16.91; Atlantic/Azores 37.74,-25.67",
+	"PW": "Pacific/Palau",
+	"PY": "America/Asuncion",
+	"QA": "Asia/Qatar",
+	"RE": "Indian/Reunion",
+	"RO": "Europe/Bucharest",
+	"RS": "Europe/Belgrade",
+	"RU": "Europe/Moscow 55.76,37.62 59.94,30.31 56.33,44.00 55.79,49.12 47.24,39.71 45.04,38.98 68.97,33.08 64.54,40.54; " +
+		"Europe/Kaliningrad 54.71,20.51; Europe/Kirov 58.60,49.66; Europe/Volgograd 48.71,44.51; " +
+		"Europe/Astrakhan 46.35,48.04; Europe/Saratov 51.53,46.03; Europe/Ulyanovsk 54.32,48.40; " +
+		"Europe/Samara 53.20,50.15 56.85,53.20; Asia/Yekaterinburg 56.84,60.61 55.16,61.40 54.74,55.97 58.01,56.25 57.15,65.53; " +
+		"Asia/Omsk 54.99,73.37; Asia/Novosibirsk 55.03,82.92; Asia/Barnaul 53.35,83.78; Asia/Tomsk 56.50,84.97; " +
+		"Asia/Novokuznetsk 53.76,87.14 55.35,86.09; Asia/Krasnoyarsk 56.02,92.87 69.35,88.20; " +
+		"Asia/Irkutsk 52.29,104.28 51.83,107.58; Asia/Chita 52.03,113.50; Asia/Yakutsk 62.03,129.73; " +
+		"Asia/Khandyga 62.66,135.55; Asia/Vladivostok 43.12,131.89 48.48,135.08; Asia/Ust-Nera 64.56,143.23; " +
+		"Asia/Magadan 59.57,150.80; Asia/Sakhalin 46.96,142.73; Asia/Srednekolymsk 67.45,153.68; " +
+		"Asia/Kamchatka 53.02,158.65; Asia/Anadyr 64.73,177.51",
+	"RW": "Africa/Kigali",
+	"SA": "Asia/Riyadh",
+	"SB": "Pacific/Guadalcanal",
+	"SC": "Indian/Mahe",
+	"SD": "Africa/Khartoum",
+	"SE": "Europe/Stockholm",
+	"SG": "Asia/Singapore",
+	"SH": "Atlantic/St_Helena",
+	"SI": "Europe/Ljubljana",
+	"SJ": "Arctic/Longyearbyen",
+	"SK": "Europe/Bratislava",
+	"SL": "Africa/Freetown",
+	"SM": "Europe/San_Marino",
+	"SN": "Africa/Dakar",
+	"SO": "Africa/Mogadishu",
+	"SR": "America/Paramaribo",
+	"SS": "Africa/Juba",
+	"ST": "Africa/Sao_Tome",
+	"SV": "America/El_Salvador",
+	"SX": "America/Lower_Princes",
+	"SY": "Asia/Damascus",
+	"SZ": "Africa/Mbabane",
+	"TC": "America/Grand_Turk",
+	"TD": "Africa/Ndjamena",
+	"TF": "Indian/Kerguelen",
+	"TG": "Africa/Lome",
+	"TH": "Asia/Bangkok",
+	"TJ": "Asia/Dushanbe",
+	"TK": "Pacific/Fakaofo",
+	"TL": "Asia/Dili",
+	"TM": "Asia/Ashgabat",
+	"TN": "Africa/Tunis",
+	"TO": "Pacific/Tongatapu",
+	"TR": "Europe/Istanbul",
+	"TT": "America/Port_of_Spain",
+	"TV": "Pacific/Funafuti",
+	"TW": "Asia/Taipei",
+	"TZ": "Africa/Dar_es_Salaam",
+	"UA": "Europe/Kyiv 50.45,30.52 49.84,24.03 46.48,30.73 49.99,36.23; Europe/Simferopol 44.95,34.10 44.62,33.53",
+	"UG": "Africa/Kampala",
+	"UM": "Pacific/Midway 28.21,-177.38; Pacific/Wake 19.28,166.65",
+	"US": "America/New_York 40.71,-74.01 42.36,-71.06 38.91,-77.04 33.75,-84.39 25.77,-80.19 35.23,-80.84 " +
+		"39.95,-75.17 39.96,-83.00 27.95,-82.46 43.05,-76.15 44.48,-73.21 32.08,-81.09 30.44,-84.28 37.54,-77.44; " +
+		"America/Detroit 42.33,-83.05 42.96,-85.67 44.76,-85.62; America/Kentucky/Louisville 38.25,-85.76; " +
+		"America/Kentucky/Monticello 36.83,-84.85; America/Indiana/Indianapolis 39.77,-86.16 41.08,-85.14; " +
+		"America/Indiana/Vincennes 38.68,-87.53; America/Indiana/Winamac 41.05,-86.60; " +
+		"America/Indiana/Marengo 38.38,-86.34; America/Indiana/Petersburg 38.49,-87.28; " +
+		"America/Indiana/Vevay 38.75,-85.07; America/Indiana/Tell_City 37.95,-86.76; America/Indiana/Knox 41.30,-86.63; " +
+		"America/Chicago 41.85,-87.65 32.78,-96.80 29.76,-95.37 29.42,-98.49 44.98,-93.27 39.10,-94.58 38.63,-90.20 " +
+		"29.95,-90.07 36.16,-86.78 43.04,-87.91 35.47,-97.52 41.26,-95.94 33.52,-86.80 35.15,-90.05 41.59,-93.62 " +
+		"43.55,-96.73 30.69,-88.04 30.27,-97.74 27.80,-97.40 33.58,-101.85 46.88,-96.79 37.69,-97.34; " +
+		"America/Menominee 45.11,-87.61; America/North_Dakota/Center 47.12,-101.30; " +
+		"America/North_Dakota/New_Salem 46.85,-101.41; America/North_Dakota/Beulah 47.26,-101.78; " +
+		"America/Denver 39.74,-104.98 40.76,-111.89 35.08,-106.65 31.76,-106.49 45.78,-108.50 41.14,-104.82 46.59,-112.04; " +
+		"America/Boise 43.62,-116.20; America/Phoenix 33.45,-112.07 32.22,-110.97 35.20,-111.65; " +
+		"America/Los_Angeles 34.05,-118.24 37.77,-122.42 47.61,-122.33 45.52,-122.68 36.17,-115.14 32.72,-117.16 " +
+		"38.58,-121.49 47.66,-117.43 39.53,-119.81 44.05,-123.09; " +
+		"America/Anchorage 61.22,-149.90 64.84,-147.72; America/Juneau 58.30,-134.42; America/Sitka 57.05,-135.33; " +
+		"America/Metlakatla 55.13,-131.57; America/Yakutat 59.55,-139.73; America/Nome 64.50,-165.41; " +
+		"America/Adak 51.88,-176.66; Pacific/Honolulu 21.31,-157.86 19.71,-155.08",
+	"UY": "America/Montevideo",
+	"UZ": "Asia/Tashkent 41.30,69.24 40.78,72.34; Asia/Samarkand 39.65,66.96 42.46,59.60",
+	"VA": "Europe/Vatican",
+	"VC": "America/St_Vincent",
+	"VE": "America/Caracas",
+	"VG": "America/Tortola",
+	"VI": "America/St_Thomas",
+	"VN": "Asia/Ho_Chi_Minh",
+	"VU": "Pacific/Efate",
+	"WF": "Pacific/Wallis",
+	"WS": "Pacific/Apia",
+	"XK": "Europe/Belgrade",
+	"YE": "Asia/Aden",
+	"YT": "Indian/Mayotte",
+	"ZA": "Africa/Johannesburg",
+	"ZM": "Africa/Lusaka",
+	"ZW": "Africa/Harare",
+}
+
+// zoneRef is a time zone, or a reference city in it.
+type zoneRef struct {
+	name     string
+	lat, lon float64
+}
+
+// countryZoneRefs holds countryZones parsed, by country code.
+var countryZoneRefs = map[string][]zoneRef{}
+
+func init() {
+	for country, zones := range countryZones {
+		for _, zone := range strings.Split(zones, ";") {
+			fields := strings.Fields(zone)
+			if len(fields) == 1 {
+				countryZoneRefs[country] = append(countryZoneRefs[country], zoneRef{name: fields[0]})
+				continue
+			}
+			for _, coords := range fields[1:] {
+				latStr, lonStr, _ := strings.Cut(coords, ",")
+				lat, latErr := strconv.ParseFloat(latStr, 64)
+				lon, lonErr := strconv.ParseFloat(lonStr, 64)
+				if latErr != nil || lonErr != nil {
+					panic(fmt.Sprintf("invalid coordinates %q for time zone %s", coords, fields[0]))
+				}
+				countryZoneRefs[country] = append(countryZoneRefs[country], zoneRef{name: fields[0], lat: lat, lon: lon})
+			}
+		}
+	}
+}
+
+// timezoneNameOf returns the IANA time zone of the record. Zone names from
+// the database (MMDB files) are used as is; otherwise the zone is taken from
+// the country, and for countries with several zones from the nearest
+// reference city. It returns "" when the zone cannot be determined.
+func timezoneNameOf(record IP2Locationrecord) string {
+	if strings.Contains(record.Timezone, "/") {
+		return record.Timezone
+	}
+
+	refs := countryZoneRefs[record.Country_short]
+	if len(refs) == 1 {
+		return refs[0].name
+	}
+	if len(refs) == 0 || (record.Latitude == 0 && record.Longitude == 0) {
+		return ""
+	}
+
+	nearest, nearestKm := "", math.Inf(1)
+	for _, ref := range refs {
+		km := distanceKm(float64(record.Latitude), float64(record.Longitude), ref.lat, ref.lon)
+		if km < nearestKm {
+			nearest, nearestKm = ref.name, km
+		}
+	}
+	return nearest
+}
+
+// zoneLocationEntry is a cached time zone; ok is false for names the time
+// zone database does not know, so they are not looked up again.
+type zoneLocationEntry struct {
+	loc *time.Location
+	ok  bool
+}
+
+// zoneLocations caches loaded time zones by name.
+var zoneLocations = struct {
+	sync.RWMutex
+	m map[string]zoneLocationEntry
+}{m: map[string]zoneLocationEntry{}}
+
+// zoneLocation returns the time zone called name, and false when it cannot
+// be loaded.
+func zoneLocation(name string) (*time.Location, bool) {
+	zoneLocations.RLock()
+	e, cached := zoneLocations.m[name]
+	zoneLocations.RUnlock()
+	if cached {
+		return e.loc, e.ok
+	}
+
+	loc, err := time.LoadLocation(name)
+	e = zoneLocationEntry{loc: loc, ok: err == nil}
+	zoneLocations.Lock()
+	zoneLocations.m[name] = e
+	zoneLocations.Unlock()
+	return e.loc, e.ok
+}
+
+// checkZoneinfo reports an error when the IANA time zone database needed
+// for utc_offset and local_time is missing.
+func checkZoneinfo() error {
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		return fmt.Errorf("utc_offset and local_time need the IANA time zone database, install tzdata or set ZONEINFO: %w", err)
+	}
+	return nil
+}
+
+// addTimezoneHeaders sets the IANA zone name, its current UTC offset and the
+// local time of the client.
+func (g *GeoIP) addTimezoneHeaders(header http.Header, record IP2Locationrecord) {
+	if record.Timezonename == "" {
+		return
+	}
+	if g.timezoneName != "" {
+		header.Set(g.timezoneName, record.Timezonename)
+	}
+	if g.utcOffset == "" && g.localTime == "" {
+		return
+	}
+
+	loc, ok := zoneLocation(record.Timezonename)
+	if !ok {
+		return
+	}
+	local := g.now().In(loc)
+	if g.utcOffset != "" {
+		header.Set(g.utcOffset, local.Format("-07:00"))
+	}
+	if g.localTime != "" {
+		header.Set(g.localTime, local.Format(time.RFC3339))
+	}
+}
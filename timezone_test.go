@@ -0,0 +1,156 @@
+package traefik_plugin_ip2location
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCountryZones(t *testing.T) {
+	for country, refs := range countryZoneRefs {
+		if _, ok := countryContinent[country]; !ok {
+			t.Errorf("%s: unknown country code", country)
+		}
+		for _, ref := range refs {
+			if _, err := time.LoadLocation(ref.name); err != nil {
+				t.Errorf("%s: %v", country, err)
+			}
+			if len(refs) > 1 && ref.lat == 0 && ref.lon == 0 {
+				t.Errorf("%s: %s has no reference city", country, ref.name)
+			}
+		}
+	}
+}
+
+func TestTimezoneNameOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		record IP2Locationrecord
+		want   string
+	}{
+		{"name from the database", IP2Locationrecord{Country_short: "US", Timezone: "America/Denver"}, "America/Denver"},
+		{"single zone", IP2Locationrecord{Country_short: "DE", Timezone: "+01:00"}, "Europe/Berlin"},
+		{"New York", IP2Locationrecord{Country_short: "US", Latitude: 40.71, Longitude: -74.01}, "America/New_York"},
+		{"El Paso", IP2Locationrecord{Country_short: "US", Latitude: 31.76, Longitude: -106.45}, "America/Denver"},
+		{"Seattle", IP2Locationrecord{Country_short: "US", Latitude: 47.60, Longitude: -122.30}, "America/Los_Angeles"},
+		{"Perth", IP2Locationrecord{Country_short: "AU", Latitude: -31.95, Longitude: 115.86}, "Australia/Perth"},
+		{"Vladivostok", IP2Locationrecord{Country_short: "RU", Latitude: 43.12, Longitude: 131.89}, "Asia/Vladivostok"},
+		{"several zones without coordinates", IP2Locationrecord{Country_short: "US"}, ""},
+		{"unknown country", IP2Locationrecord{Country_short: "-"}, ""},
+	}
+	for _, tt := range tests {
+		if got := timezoneNameOf(tt.record); got != tt.want {
+			t.Errorf("%s: timezoneNameOf = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestZoneLocation(t *testing.T) {
+	if loc, ok := zoneLocation("Europe/Berlin"); !ok || loc.String() != "Europe/Berlin" {
+		t.Errorf("zoneLocation(Europe/Berlin) = %v, %v", loc, ok)
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := zoneLocation("Nowhere/Atlantis"); ok {
+			t.Error("zoneLocation(Nowhere/Atlantis) succeeded")
+		}
+	}
+	zoneLocations.RLock()
+	e, cached := zoneLocations.m["Nowhere/Atlantis"]
+	zoneLocations.RUnlock()
+	if !cached || e.ok {
+		t.Errorf("unknown zone cached = %v, %+v, want a negative entry", cached, e)
+	}
+}
+
+func TestGeoIP_TimezoneResolvedOnDemand(t *testing.T) {
+	dbPath := buildTestBIN(t, 5, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB", "latitude": "51.5074", "longitude": "-0.1278"}},
+		{from: "81.2.70.0"},
+	})
+
+	tests := []struct {
+		name   string
+		config *Config
+		want   string
+	}{
+		{"no time zone output", &Config{Filename: dbPath, CountryCode: "X-Country-Code"}, ""},
+		{"geo header without the field", &Config{Filename: dbPath, GeoHeader: "X-Geo", GeoHeaderFields: []string{"country_code"}}, ""},
+		{"geo header with all fields", &Config{Filename: dbPath, GeoHeader: "X-Geo"}, "Europe/London"},
+		{"geo endpoint", &Config{Filename: dbPath, GeoEndpoint: "/geo"}, "Europe/London"},
+		{"utc offset", &Config{Filename: dbPath, UtcOffset: "X-Utc-Offset"}, "Europe/London"},
+	}
+	for _, tt := range tests {
+		handler, err := New(context.Background(), &httpHandlerMock{}, tt.config, "test")
+		if err != nil {
+			t.Fatalf("%s: failed to create plugin: %v", tt.name, err)
+		}
+		record, err := handler.(*GeoIP).lookup(net.ParseIP("81.2.69.1"))
+		if err != nil {
+			t.Fatalf("%s: lookup failed: %v", tt.name, err)
+		}
+		if record.Timezonename != tt.want {
+			t.Errorf("%s: Timezonename = %q, want %q", tt.name, record.Timezonename, tt.want)
+		}
+	}
+}
+
+func TestGeoIP_Timezone(t *testing.T) {
+	dbPath := buildTestBIN(t, 5, []testBINRow{
+		{from: "81.2.69.0", fields: map[string]string{"country_short": "GB", "latitude": "51.5074", "longitude": "-0.1278"}},
+		{from: "81.2.70.0", fields: map[string]string{"country_short": "US", "latitude": "34.0522", "longitude": "-118.2437"}},
+		{from: "81.2.71.0", fields: map[string]string{"country_short": "US"}},
+		{from: "81.2.72.0"},
+	})
+
+	handler, err := New(context.Background(), &httpHandlerMock{}, &Config{
+		Filename:     dbPath,
+		TimezoneName: "X-Timezone-Name",
+		UtcOffset:    "X-Utc-Offset",
+		LocalTime:    "X-Local-Time",
+	}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		remote string
+		now    time.Time
+		want   map[string]string
+	}{
+		{"81.2.69.1:1234", time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC), map[string]string{
+			"X-Timezone-Name": "Europe/London",
+			"X-Utc-Offset":    "+00:00",
+			"X-Local-Time":    "2026-01-15T12:00:00Z",
+		}},
+		{"81.2.69.1:1234", time.Date(2026, 7, 15, 12, 0, 0, 0, time.UTC), map[string]string{
+			"X-Timezone-Name": "Europe/London",
+			"X-Utc-Offset":    "+01:00",
+			"X-Local-Time":    "2026-07-15T13:00:00+01:00",
+		}},
+		{"81.2.70.1:1234", time.Date(2026, 7, 15, 12, 0, 0, 0, time.UTC), map[string]string{
+			"X-Timezone-Name": "America/Los_Angeles",
+			"X-Utc-Offset":    "-07:00",
+			"X-Local-Time":    "2026-07-15T05:00:00-07:00",
+		}},
+		// several zones and no coordinates, or no country
+		{"81.2.71.1:1234", time.Now(), map[string]string{"X-Timezone-Name": "", "X-Utc-Offset": "", "X-Local-Time": ""}},
+		{"81.2.72.1:1234", time.Now(), map[string]string{"X-Timezone-Name": "", "X-Utc-Offset": "", "X-Local-Time": ""}},
+	}
+	for _, tt := range tests {
+		now := tt.now
+		handler.(*GeoIP).now = func() time.Time { return now }
+
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.RemoteAddr = tt.remote
+		req.Header.Set("X-Timezone-Name", "Etc/UTC")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		for header, want := range tt.want {
+			if got := req.Header.Get(header); got != want {
+				t.Errorf("%s at %s: %s = %q, want %q", tt.remote, tt.now.Format(time.RFC3339), header, got, want)
+			}
+		}
+	}
+}